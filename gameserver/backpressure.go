@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// BackpressurePolicy decides what happens when a channel is full.
+type BackpressurePolicy int
+
+const (
+	// DropNewest drops the message that does not fit (the original behavior).
+	DropNewest BackpressurePolicy = iota
+	// DropOldest evicts the oldest queued message to make room for the new one.
+	DropOldest
+	// BlockWithTimeout waits up to Options.BlockTimeout for room, then drops the message.
+	BlockWithTimeout
+	// DisconnectSlow drops the message and disconnects the player who could not keep up.
+	// On a map channel, where there is no player to blame, it behaves like DropNewest.
+	DisconnectSlow
+)
+
+// counters are the message counters of a player or a map.
+type counters struct {
+	sent      atomic.Uint64
+	delivered atomic.Uint64
+	dropped   atomic.Uint64
+}
+
+// PlayerStats are the message counters of a player.
+type PlayerStats struct {
+	Name      string `json:"name"`
+	Sent      uint64 `json:"sent"`      // messages sent by the player (chat and whispers)
+	Delivered uint64 `json:"delivered"` // messages put in the player's channel
+	Dropped   uint64 `json:"dropped"`   // messages lost because the player's channel was full
+}
+
+// MapStats are the message counters of a map.
+type MapStats struct {
+	ID        int    `json:"id"`
+	Sent      uint64 `json:"sent"`      // messages accepted in the map's channel
+	Delivered uint64 `json:"delivered"` // copies delivered to players by the fan-out
+	Dropped   uint64 `json:"dropped"`   // messages rejected or evicted from the map's channel, plus copies dropped by the fan-out
+}
+
+// GameStats is a snapshot of every counter of the game.
+type GameStats struct {
+	Maps    []MapStats    // sorted by ID
+	Players []PlayerStats // sorted by name
+}
+
+// Stats returns the message counters of the player.
+func (p *Player) Stats() PlayerStats {
+	return PlayerStats{
+		Name:      p.name,
+		Sent:      p.stats.sent.Load(),
+		Delivered: p.stats.delivered.Load(),
+		Dropped:   p.stats.dropped.Load(),
+	}
+}
+
+// Stats returns the message counters of the map.
+func (m *Map) Stats() MapStats {
+	return MapStats{
+		ID:        m.id,
+		Sent:      m.stats.sent.Load(),
+		Delivered: m.stats.delivered.Load(),
+		Dropped:   m.stats.dropped.Load(),
+	}
+}
+
+// Stats returns the counters of every map and every connected player.
+func (g *Game) Stats() GameStats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	s := GameStats{
+		Maps:    make([]MapStats, 0, len(g.maps)),
+		Players: make([]PlayerStats, 0, len(g.players)),
+	}
+	for _, m := range g.maps {
+		s.Maps = append(s.Maps, m.Stats())
+	}
+	for _, p := range g.players {
+		s.Players = append(s.Players, p.Stats())
+	}
+	sort.Slice(s.Maps, func(i, j int) bool { return s.Maps[i].ID < s.Maps[j].ID })
+	sort.Slice(s.Players, func(i, j int) bool { return s.Players[i].Name < s.Players[j].Name })
+	return s
+}
+
+// enqueue puts a message in the map's channel following the backpressure policy.
+// When mayBlock is false (callers holding locks), a full channel always drops the message.
+// A blocking send gives up when ctx ends, and returns its error.
+func (m *Map) enqueue(ctx context.Context, msg Message, mayBlock bool) error {
+	// Hold the send lock for reading, so Shutdown cannot close the channel under us.
+	m.sendMu.RLock()
+	defer m.sendMu.RUnlock()
+	if m.closed {
+		return ErrMapClosed
+	}
+
+	sent := false
+	switch policy := m.g.opts; {
+	case policy.Backpressure == DropOldest:
+		sent = sendEvictingOldest(m.ch, msg, &m.stats)
+	case policy.Backpressure == BlockWithTimeout && mayBlock:
+		sent = sendWithTimeout(ctx, m.ch, msg, policy.BlockTimeout)
+	default:
+		sent = trySend(m.ch, msg)
+	}
+
+	if !sent {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		m.stats.dropped.Add(1)
+		m.g.log.Warn("message dropped", "map", m.id, "sender", msg.Sender, "reason", "map channel is full")
+		return fmt.Errorf("map %w", ErrChannelFull)
+	}
+	m.stats.sent.Add(1)
+	return nil
+}
+
+// deliver puts a message in the player's channel following the backpressure policy,
+// and reports whether it was delivered. Every delivery path goes through it.
+// When mayBlock is false, a full channel always drops the message: callers holding
+// g.mu or a map lock must not wait for a slow client. Those locks also make sure
+// p.ch is not closed; a blocking delivery, made without them, relies on p.sendMu.
+// With DisconnectSlow, the caller disconnects the player after releasing the map lock.
+func (p *Player) deliver(msg Message, mayBlock bool) bool {
+	sent := false
+	switch policy := p.g.opts; {
+	case policy.Backpressure == DropOldest:
+		sent = sendEvictingOldest(p.ch, msg, &p.stats)
+	case policy.Backpressure == BlockWithTimeout && mayBlock:
+		sent = p.sendWithTimeout(msg, policy.BlockTimeout)
+	default:
+		sent = trySend(p.ch, msg)
+	}
+
+	if !sent {
+		p.stats.dropped.Add(1)
+		p.g.log.Warn("message dropped", "player", p.name, "map", msg.Map, "kind", msg.Kind, "reason", "player channel is full")
+		return false
+	}
+	p.stats.delivered.Add(1)
+	return true
+}
+
+// sendWithTimeout waits up to timeout for room in the player's channel, unless
+// the player is disconnected in the meantime.
+func (p *Player) sendWithTimeout(msg Message, timeout time.Duration) bool {
+	p.sendMu.RLock()
+	defer p.sendMu.RUnlock()
+	if p.closed {
+		return false
+	}
+	return sendUntil(p.ch, msg, timeout, p.gone)
+}
+
+// close closes the player's channel, once no blocking delivery is sending on it.
+// Closing p.gone first wakes them up, so this never waits for a timeout.
+func (p *Player) close() {
+	close(p.gone)
+	p.sendMu.Lock()
+	p.closed = true
+	close(p.ch)
+	p.sendMu.Unlock()
+}
+
+// dropSlow disconnects p if the policy is DisconnectSlow. The caller must hold g.mu.
+func (g *Game) dropSlow(p *Player) {
+	if g.opts.Backpressure == DisconnectSlow && g.players[strings.ToLower(p.name)] == p {
+		g.removePlayer(p)
+	}
+}
+
+// trySend sends without blocking: the message is dropped if ch is full.
+func trySend(ch chan Message, msg Message) bool {
+	select {
+	case ch <- msg:
+		return true
+	default:
+		return false
+	}
+}
+
+// sendWithTimeout waits up to timeout for room in ch, or until ctx ends.
+func sendWithTimeout(ctx context.Context, ch chan Message, msg Message, timeout time.Duration) bool {
+	return sendUntil(ch, msg, timeout, ctx.Done())
+}
+
+// sendUntil waits up to timeout for room in ch, or until stop is closed.
+func sendUntil(ch chan Message, msg Message, timeout time.Duration, stop <-chan struct{}) bool {
+	if trySend(ch, msg) {
+		return true
+	}
+	t := time.NewTimer(timeout)
+	defer t.Stop()
+	select {
+	case ch <- msg:
+		return true
+	case <-t.C:
+		return false
+	case <-stop:
+		return false
+	}
+}
+
+// sendEvictingOldest makes room in a full channel by removing its oldest message,
+// which is counted as dropped. It can still fail if other senders keep filling ch.
+func sendEvictingOldest(ch chan Message, msg Message, c *counters) bool {
+	for attempt := 0; attempt < 3; attempt++ {
+		if trySend(ch, msg) {
+			return true
+		}
+		select {
+		case <-ch:
+			c.dropped.Add(1)
+		default:
+		}
+	}
+	return false
+}
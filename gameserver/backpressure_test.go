@@ -0,0 +1,175 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newSleeperGame connects a reader and a sleeper (who never reads) with the given options.
+func newSleeperGame(t *testing.T, opts Options) (*Game, *Player, *Player) {
+	g, _ := newTestGame(t, []int{1}, opts)
+	g.ConnectPlayer("Reader")
+	g.ConnectPlayer("Sleeper")
+	reader, _ := g.GetPlayer("Reader")
+	sleeper, _ := g.GetPlayer("Sleeper")
+	return g, reader, sleeper
+}
+
+// fill broadcasts until the sleeper's channel is full.
+func fill(t *testing.T, g *Game, reader, sleeper *Player) {
+	for i := len(sleeper.ch); i < cap(sleeper.ch); i++ {
+		require.Nil(t, g.Broadcast("filler"))
+		<-reader.GetChannel()
+	}
+}
+
+func TestBackpressureDropNewest(t *testing.T) {
+	g, reader, sleeper := newSleeperGame(t, Options{})
+	fill(t, g, reader, sleeper)
+
+	var drop *DropError
+	assert.True(t, errors.As(g.Broadcast("lost"), &drop))
+	assert.Equal(t, "filler", (<-sleeper.GetChannel()).Text(), "the queued messages are kept")
+
+	s := sleeper.Stats()
+	assert.Equal(t, uint64(cap(sleeper.ch)), s.Delivered)
+	assert.Equal(t, uint64(1), s.Dropped)
+}
+
+func TestBackpressureDropOldest(t *testing.T) {
+	g, reader, sleeper := newSleeperGame(t, Options{Backpressure: DropOldest})
+	fill(t, g, reader, sleeper)
+
+	assert.Nil(t, g.Broadcast("newest"))
+	assert.Equal(t, cap(sleeper.ch), len(sleeper.ch))
+	var last Message
+	for len(sleeper.ch) > 0 {
+		last = <-sleeper.GetChannel()
+	}
+	assert.Equal(t, "newest", last.Text())
+	assert.Equal(t, uint64(1), sleeper.Stats().Dropped, "the oldest message was evicted")
+}
+
+// newStalledMap puts a reader and a sleeper in map 1 with the BlockWithTimeout
+// policy, and fills the sleeper's channel through the map.
+func newStalledMap(t *testing.T, timeout time.Duration) (*Game, *Player, *Player) {
+	g, _ := newTestGame(t, []int{1}, Options{Backpressure: BlockWithTimeout, BlockTimeout: timeout})
+	reader := join(t, g, "Reader", 1)
+	sleeper := join(t, g, "Sleeper", 1)
+	for i := len(sleeper.ch); i < cap(sleeper.ch); i++ {
+		require.NoError(t, reader.SendMessage("filler"))
+	}
+	require.Eventually(t, func() bool { return len(sleeper.ch) == cap(sleeper.ch) }, 2*time.Second, time.Millisecond)
+	return g, reader, sleeper
+}
+
+func TestBackpressureBlockWithTimeout(t *testing.T) {
+	// Nobody reads: the fan-out gives up after the timeout.
+	_, reader, sleeper := newStalledMap(t, 20*time.Millisecond)
+	require.NoError(t, reader.SendMessage("late"))
+	assert.Eventually(t, func() bool { return sleeper.Stats().Dropped == 1 }, 2*time.Second, time.Millisecond)
+
+	// The sleeper wakes up in time: the message waits for room instead of being dropped.
+	_, reader, sleeper = newStalledMap(t, 2*time.Second)
+	require.NoError(t, reader.SendMessage("on time"))
+	time.Sleep(10 * time.Millisecond)
+	<-sleeper.GetChannel()
+	var last Message
+	for last.Body != "on time" {
+		last = <-sleeper.GetChannel()
+	}
+	assert.Equal(t, uint64(0), sleeper.Stats().Dropped)
+
+	// Whispers are sent under the game lock: they never wait.
+	_, reader, _ = newStalledMap(t, time.Minute)
+	var drop *DropError
+	assert.True(t, errors.As(reader.Whisper("Sleeper", "psst"), &drop))
+}
+
+func TestBackpressureStalledClient(t *testing.T) {
+	g, reader, sleeper := newStalledMap(t, time.Minute)
+	require.NoError(t, g.AddMap(2, MapOptions{}))
+
+	// The fan-out records the chat under the map lock, then waits for the
+	// sleeper without any lock held.
+	require.NoError(t, reader.SendMessage("stuck"))
+	require.Eventually(t, func() bool {
+		msgs, _ := g.maps[1].History(0, 0)
+		return msgs[len(msgs)-1].Body == "stuck"
+	}, 2*time.Second, time.Millisecond)
+
+	// Meanwhile the game lock and the map lock are free.
+	start := time.Now()
+	var drop *DropError
+	assert.True(t, errors.As(g.Broadcast("announcement"), &drop))
+	require.NoError(t, g.ConnectPlayer("Carol"))
+	require.NoError(t, g.SwitchPlayerMap("Carol", 1))
+	require.NoError(t, g.SwitchPlayerMap("Reader", 2))
+	assert.Equal(t, []string{"Carol", "Sleeper"}, g.maps[1].PlayerNames())
+	assert.Less(t, time.Since(start), time.Second)
+
+	// Disconnecting the sleeper wakes the fan-out up at once.
+	require.NoError(t, g.DisconnectPlayer("Sleeper"))
+	assert.Eventually(t, func() bool { return sleeper.Stats().Dropped >= 2 }, time.Second, time.Millisecond)
+}
+
+func TestBackpressureDisconnectSlow(t *testing.T) {
+	g, reader, sleeper := newSleeperGame(t, Options{Backpressure: DisconnectSlow})
+	g.SwitchPlayerMap("Reader", 1)
+	g.SwitchPlayerMap("Sleeper", 1)
+	<-reader.GetChannel() // welcome
+	<-reader.GetChannel() // Sleeper joined
+
+	// Fill the sleeper's channel through the map, then overflow it.
+	for i := len(sleeper.ch); i <= cap(sleeper.ch); i++ {
+		require.NoError(t, reader.SendMessage("spam"))
+	}
+
+	assert.Eventually(t, func() bool {
+		_, err := g.GetPlayer("Sleeper")
+		return err != nil
+	}, 2*time.Second, 5*time.Millisecond, "the slow player is disconnected")
+	assert.Equal(t, uint64(1), sleeper.Stats().Dropped)
+	for msg := range reader.GetChannel() {
+		if msg.Kind == KindLeave {
+			assert.Equal(t, "Sleeper left", msg.Text())
+			break
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	g, _ := NewGame([]int{2, 1})
+	g.ConnectPlayer("Bob")
+	g.ConnectPlayer("Alice")
+	g.SwitchPlayerMap("Alice", 1)
+	g.SwitchPlayerMap("Bob", 1)
+	alice, _ := g.GetPlayer("Alice")
+	bob, _ := g.GetPlayer("Bob")
+	<-alice.GetChannel() // welcome
+	<-alice.GetChannel() // Bob joined
+	<-bob.GetChannel()   // welcome
+
+	require.NoError(t, alice.SendMessage("hi"))
+	assert.Equal(t, "Alice says: hi", (<-bob.GetChannel()).Text())
+	require.NoError(t, alice.Whisper("Bob", "psst"))
+	<-bob.GetChannel()
+
+	// Counters are updated right after the send, so wait for them to settle.
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		s := g.Stats()
+		assert.Equal(c, []PlayerStats{
+			{Name: "Alice", Sent: 2, Delivered: 2},
+			{Name: "Bob", Delivered: 3},
+		}, s.Players)
+		assert.Equal(c, []MapStats{
+			// Two join notices and the chat went through the map; Alice's own join notice reached nobody.
+			{ID: 1, Sent: 3, Delivered: 2},
+			{ID: 2},
+		}, s.Maps)
+	}, 2*time.Second, 5*time.Millisecond)
+}
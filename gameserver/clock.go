@@ -0,0 +1,42 @@
+package main
+
+import "time"
+
+// Clock is the source of time of a Game. The default is the system clock;
+// tests inject a manual one to step the game deterministically.
+type Clock interface {
+	Now() time.Time
+	// NewTicker returns a ticker firing every d, like time.NewTicker.
+	NewTicker(d time.Duration) Ticker
+	// AfterFunc calls f in its own goroutine after d, like time.AfterFunc.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Ticker is the part of time.Ticker a Game uses.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Timer is the part of time.Timer a Game uses.
+type Timer interface {
+	Stop() bool
+}
+
+// systemClock is the Clock backed by the time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+func (systemClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+type systemTicker struct{ t *time.Ticker }
+
+func (t systemTicker) C() <-chan time.Time { return t.t.C }
+func (t systemTicker) Stop()               { t.t.Stop() }
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrUnknownCommand is returned for a slash-command without a handler.
+var ErrUnknownCommand = errors.New("unknown command")
+
+// Command is a slash-command sent by a player, like "/join 3 secret".
+type Command struct {
+	Player *Player
+	Name   string   // lowercase, without the slash: "join"
+	Args   []string // the words after the name: ["3", "secret"]
+	Text   string   // everything after the name, trimmed: "3 secret"
+}
+
+// CommandHandler runs a command. Its error is returned to the player by SendMessage.
+type CommandHandler func(ctx context.Context, cmd Command) error
+
+// HandleCommand registers the handler of /name, replacing the previous one if
+// any. Every game starts with /me, /who, /join and /roll, and the moderator
+// commands /kick, /ban and /mute.
+func (g *Game) HandleCommand(name string, h CommandHandler) {
+	g.commandMu.Lock()
+	defer g.commandMu.Unlock()
+	g.commands[strings.ToLower(name)] = h
+}
+
+// registerBuiltinCommands registers the commands every game starts with.
+func (g *Game) registerBuiltinCommands() {
+	g.HandleCommand("me", commandMe)
+	g.HandleCommand("who", commandWho)
+	g.HandleCommand("join", commandJoin)
+	g.HandleCommand("roll", commandRoll)
+	g.HandleCommand("kick", commandKick)
+	g.HandleCommand("ban", commandBan)
+	g.HandleCommand("mute", commandMute)
+}
+
+// parseCommand splits a message starting with a slash into a command.
+// "//text" is not a command: it sends "/text".
+func parseCommand(p *Player, text string) (Command, bool) {
+	if !strings.HasPrefix(text, "/") || strings.HasPrefix(text, "//") {
+		return Command{}, false
+	}
+	name, rest, _ := strings.Cut(text[1:], " ")
+	rest = strings.TrimSpace(rest)
+	return Command{
+		Player: p,
+		Name:   strings.ToLower(name),
+		Args:   strings.Fields(rest),
+		Text:   rest,
+	}, true
+}
+
+// runCommand dispatches cmd to its handler.
+func (g *Game) runCommand(ctx context.Context, cmd Command) error {
+	g.commandMu.RLock()
+	h, ok := g.commands[cmd.Name]
+	g.commandMu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: /%s", ErrUnknownCommand, cmd.Name)
+	}
+	return h(ctx, cmd)
+}
+
+// Notice sends the player a system message only it sees, such as the reply to a command.
+func (p *Player) Notice(text string) error {
+	g := p.g
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.players[strings.ToLower(p.name)] != p {
+		return ErrNotConnected
+	}
+	if !p.deliver(g.newMessage("", max(p.zone, 0), KindSystem, text), false) {
+		g.dropSlow(p)
+		return &DropError{Players: []string{p.name}}
+	}
+	return nil
+}
+
+// commandMe sends an action to the map: "/me waves" is shown as "* Alice waves".
+func commandMe(ctx context.Context, cmd Command) error {
+	if cmd.Text == "" {
+		return errors.New("usage: /me <action>")
+	}
+	return cmd.Player.say(ctx, KindEmote, cmd.Text)
+}
+
+// commandWho tells the player who is in its map.
+func commandWho(_ context.Context, cmd Command) error {
+	p := cmd.Player
+	g := p.g
+	g.mu.Lock()
+	m := p.m
+	var names []string
+	if m != nil {
+		names = m.PlayerNames()
+	}
+	g.mu.Unlock()
+	if m == nil {
+		return ErrNotInMap
+	}
+	return p.Notice(fmt.Sprintf("Players in map %d: %s", m.id, strings.Join(names, ", ")))
+}
+
+// commandJoin moves the player to another map: "/join 3", or "/join 3 secret"
+// for a map with a password.
+func commandJoin(_ context.Context, cmd Command) error {
+	if len(cmd.Args) == 0 || len(cmd.Args) > 2 {
+		return errors.New("usage: /join <map> [password]")
+	}
+	id, err := strconv.Atoi(cmd.Args[0])
+	if err != nil {
+		return errors.New("usage: /join <map> [password]")
+	}
+	password := ""
+	if len(cmd.Args) == 2 {
+		password = cmd.Args[1]
+	}
+	return cmd.Player.g.SwitchPlayerMapWithPassword(cmd.Player.name, id, password)
+}
+
+// commandKick kicks a player: "/kick Troll spamming". Like Game.Kick, it is
+// only for moderators and admins.
+func commandKick(_ context.Context, cmd Command) error {
+	if len(cmd.Args) == 0 {
+		return errors.New("usage: /kick <player> [reason]")
+	}
+	reason := strings.TrimSpace(strings.TrimPrefix(cmd.Text, cmd.Args[0]))
+	return cmd.Player.g.Kick(cmd.Player.name, cmd.Args[0], reason)
+}
+
+// commandBan bans a player, for a while or for good: "/ban Troll 1h" or "/ban Troll".
+func commandBan(_ context.Context, cmd Command) error {
+	name, d, err := parseModeration(cmd, "usage: /ban <player> [duration]")
+	if err != nil {
+		return err
+	}
+	return cmd.Player.g.Ban(cmd.Player.name, name, d)
+}
+
+// commandMute mutes a player, for a while or until unmuted: "/mute Troll 10m" or "/mute Troll".
+func commandMute(_ context.Context, cmd Command) error {
+	name, d, err := parseModeration(cmd, "usage: /mute <player> [duration]")
+	if err != nil {
+		return err
+	}
+	return cmd.Player.g.Mute(cmd.Player.name, name, d)
+}
+
+// parseModeration parses the "<player> [duration]" arguments of /ban and /mute.
+// Without a duration, d is 0: the ban or mute lasts until lifted.
+func parseModeration(cmd Command, usage string) (name string, d time.Duration, err error) {
+	if len(cmd.Args) == 0 || len(cmd.Args) > 2 {
+		return "", 0, errors.New(usage)
+	}
+	if len(cmd.Args) == 2 {
+		if d, err = time.ParseDuration(cmd.Args[1]); err != nil || d <= 0 {
+			return "", 0, errors.New(usage)
+		}
+	}
+	return cmd.Args[0], d, nil
+}
+
+// Limits of /roll, so a roll stays a short message.
+const (
+	maxDice  = 100
+	maxSides = 1000
+)
+
+// commandRoll rolls dice for the map to see: "/roll 2d6" is shown as
+// "* Alice rolls 2d6: 9 (4, 5)". Without an argument it rolls 1d6.
+func commandRoll(ctx context.Context, cmd Command) error {
+	spec := "1d6"
+	if len(cmd.Args) > 0 {
+		spec = strings.ToLower(cmd.Args[0])
+	}
+	n, sides, err := parseDice(spec)
+	if err != nil {
+		return err
+	}
+
+	p := cmd.Player
+	rolls := make([]string, n)
+	total := 0
+	for i := range rolls {
+		r := p.g.intN(sides) + 1
+		rolls[i] = strconv.Itoa(r)
+		total += r
+	}
+	result := fmt.Sprintf("%dd%d: %d", n, sides, total)
+	if n > 1 {
+		result += " (" + strings.Join(rolls, ", ") + ")"
+	}
+
+	// The others see an action; the player, who is not sent its own messages, gets a notice.
+	if err := p.say(ctx, KindEmote, "rolls "+result); err != nil {
+		return err
+	}
+	return p.Notice("You roll " + result)
+}
+
+// parseDice parses "NdM", or "dM" for a single die.
+func parseDice(spec string) (n, sides int, err error) {
+	invalid := fmt.Errorf("invalid dice %q: use NdM, like 1d20, with up to %d dice of up to %d sides", spec, maxDice, maxSides)
+	count, faces, ok := strings.Cut(spec, "d")
+	if !ok {
+		return 0, 0, invalid
+	}
+	n = 1
+	if count != "" {
+		if n, err = strconv.Atoi(count); err != nil {
+			return 0, 0, invalid
+		}
+	}
+	if sides, err = strconv.Atoi(faces); err != nil {
+		return 0, 0, invalid
+	}
+	if n < 1 || n > maxDice || sides < 2 || sides > maxSides {
+		return 0, 0, invalid
+	}
+	return n, sides, nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newCommandGame puts Alice and Bob in map 1, with their welcome messages read.
+// Map 3 has the password "secret".
+func newCommandGame(t *testing.T) (*Game, *Player, *Player) {
+	g, _ := newTestGame(t, []int{1, 2}, Options{})
+	require.NoError(t, g.AddMap(3, MapOptions{Password: "secret"}))
+	alice := join(t, g, "Alice", 1)
+	bob := join(t, g, "Bob", 1)
+	return g, alice, bob
+}
+
+func TestCommandMe(t *testing.T) {
+	_, alice, bob := newCommandGame(t)
+
+	require.NoError(t, alice.SendMessage("/me waves"))
+	msg := receive(t, bob)
+	assert.Equal(t, KindEmote, msg.Kind)
+	assert.Equal(t, "* Alice waves", msg.Text())
+
+	assert.EqualError(t, alice.SendMessage("/me"), "usage: /me <action>")
+}
+
+func TestCommandWho(t *testing.T) {
+	_, alice, bob := newCommandGame(t)
+
+	require.NoError(t, alice.SendMessage("/WHO"))
+	msg := receive(t, alice)
+	assert.Equal(t, KindSystem, msg.Kind)
+	assert.Equal(t, "Players in map 1: Alice, Bob", msg.Text())
+	assert.Len(t, bob.GetChannel(), 0, "only the player who asked gets the answer")
+}
+
+func TestCommandJoin(t *testing.T) {
+	g, alice, _ := newCommandGame(t)
+
+	require.NoError(t, alice.SendMessage("/join 2"))
+	assert.Equal(t, []string{"Alice"}, g.maps[2].PlayerNames())
+
+	assert.Error(t, alice.SendMessage("/join 3"))
+	require.NoError(t, alice.SendMessage("/join 3 secret"))
+	assert.Equal(t, []string{"Alice"}, g.maps[3].PlayerNames())
+
+	assert.ErrorIs(t, alice.SendMessage("/join 9"), ErrMapNotFound)
+	assert.EqualError(t, alice.SendMessage("/join"), "usage: /join <map> [password]")
+	assert.EqualError(t, alice.SendMessage("/join two"), "usage: /join <map> [password]")
+}
+
+func TestCommandRoll(t *testing.T) {
+	g, alice, bob := newCommandGame(t)
+	rolls := []int{3, 4}
+	g.intN = func(n int) int {
+		assert.Equal(t, 6, n)
+		r := rolls[0]
+		rolls = rolls[1:]
+		return r
+	}
+
+	require.NoError(t, alice.SendMessage("/roll 2d6"))
+	assert.Equal(t, "* Alice rolls 2d6: 9 (4, 5)", receive(t, bob).Text())
+	assert.Equal(t, "You roll 2d6: 9 (4, 5)", receive(t, alice).Text())
+
+	g.intN = func(n int) int { return n - 1 }
+	require.NoError(t, alice.SendMessage("/roll d20"))
+	assert.Equal(t, "* Alice rolls 1d20: 20", receive(t, bob).Text())
+	receive(t, alice)
+	require.NoError(t, alice.SendMessage("/roll"))
+	assert.Equal(t, "* Alice rolls 1d6: 6", receive(t, bob).Text())
+
+	for _, spec := range []string{"6", "xd6", "2dx", "0d6", "101d6", "1d1", "1d1001"} {
+		err := alice.SendMessage("/roll " + spec)
+		if assert.Error(t, err, spec) {
+			assert.True(t, strings.HasPrefix(err.Error(), "invalid dice"), err.Error())
+		}
+	}
+}
+
+func TestUnknownCommand(t *testing.T) {
+	_, alice, bob := newCommandGame(t)
+
+	err := alice.SendMessage("/dance")
+	assert.ErrorIs(t, err, ErrUnknownCommand)
+	assert.EqualError(t, err, "unknown command: /dance")
+
+	// Two slashes send the text as chat, with one slash.
+	require.NoError(t, alice.SendMessage("//dance"))
+	msg := receive(t, bob)
+	assert.Equal(t, KindChat, msg.Kind)
+	assert.Equal(t, "/dance", msg.Body)
+}
+
+func TestHandleCommand(t *testing.T) {
+	g, alice, _ := newCommandGame(t)
+	errAFK := errors.New("afk")
+	var got Command
+	g.HandleCommand("AFK", func(_ context.Context, cmd Command) error {
+		got = cmd
+		return errAFK
+	})
+
+	assert.ErrorIs(t, alice.SendMessage("/afk  back in 5 "), errAFK)
+	assert.Equal(t, Command{Player: alice, Name: "afk", Args: []string{"back", "in", "5"}, Text: "back in 5"}, got)
+}
+
+func TestModeratorCommands(t *testing.T) {
+	g, alice, bob := newCommandGame(t)
+
+	assert.ErrorIs(t, bob.SendMessage("/kick Alice"), ErrNotAuthorized)
+	assert.ErrorIs(t, bob.SendMessage("/mute Alice"), ErrNotAuthorized)
+	require.NoError(t, g.SetRole("", "Alice", RoleModerator))
+
+	assert.EqualError(t, alice.SendMessage("/mute"), "usage: /mute <player> [duration]")
+	assert.EqualError(t, alice.SendMessage("/ban Bob soon"), "usage: /ban <player> [duration]")
+	require.NoError(t, alice.SendMessage("/mute Bob 10m"))
+	assert.ErrorIs(t, bob.SendMessage("hi"), ErrMuted)
+
+	require.NoError(t, alice.SendMessage("/kick Bob stop it"))
+	assert.Equal(t, "You were kicked: stop it", receive(t, bob).Text())
+	require.NoError(t, g.ConnectPlayer("Bob"))
+	require.NoError(t, alice.SendMessage("/ban bob 1h"))
+	assert.ErrorIs(t, g.ConnectPlayer("Bob"), ErrPlayerBanned)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// DropError reports the players whose channel was full, so a message could not be delivered to them.
+type DropError struct {
+	Players []string
+}
+
+func (e *DropError) Error() string {
+	return "message dropped for: " + strings.Join(e.Players, ", ")
+}
+
+// Is makes errors.Is(err, ErrChannelFull) true for every *DropError.
+func (e *DropError) Is(target error) bool {
+	return target == ErrChannelFull
+}
+
+// Whisper sends a direct message to a single player, wherever they are in the game.
+// It returns a *DropError when the receiver's channel is full.
+func (p *Player) Whisper(to, msg string) error {
+	g := p.g
+	key := strings.ToLower(to)
+
+	// 1) Check the players before the message goes through the anti-spam checks.
+	g.mu.Lock()
+	_, err := g.whisperTo(p, key)
+	g.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	// 2) Screen the message and run the plugins without the lock: filters
+	// and plugins may call the game.
+	msg, err = p.screen(msg)
+	if err != nil {
+		return err
+	}
+	e := &MessageEvent{Player: p.name, To: to, Kind: KindWhisper, Text: msg}
+	if err := g.runPlugins(func(pl Plugin) error { return pl.OnMessage(e) }); err != nil {
+		return err
+	}
+
+	// 3) Holding the game lock keeps both players connected (removePlayer needs
+	// it too), so the receiver's channel cannot be closed during the send.
+	// Check them again: they may have left meanwhile.
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	receiver, err := g.whisperTo(p, key)
+	if err != nil {
+		return err
+	}
+
+	if !receiver.deliver(g.newMessage(p.name, 0, KindWhisper, e.Text), false) {
+		g.dropSlow(receiver)
+		return &DropError{Players: []string{receiver.name}}
+	}
+	p.stats.sent.Add(1)
+	return nil
+}
+
+// whisperTo returns the receiver of a whisper from p. The caller must hold g.mu.
+func (g *Game) whisperTo(p *Player, key string) (*Player, error) {
+	if g.players[strings.ToLower(p.name)] != p {
+		return nil, ErrNotConnected
+	}
+	receiver, ok := g.players[key]
+	if !ok {
+		return nil, ErrPlayerNotFound
+	}
+	if receiver == p {
+		return nil, ErrWhisperSelf
+	}
+	return receiver, nil
+}
+
+// Broadcast sends a system announcement to every connected player, whatever their map.
+// It returns a *DropError listing the players whose channel was full.
+func (g *Game) Broadcast(msg string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	announcement := g.newMessage("", 0, KindSystem, msg)
+	dropped := make([]string, 0)
+	for _, p := range g.players {
+		if !p.deliver(announcement, false) {
+			dropped = append(dropped, p.name)
+			g.dropSlow(p)
+		}
+	}
+
+	if len(dropped) > 0 {
+		sort.Strings(dropped)
+		return &DropError{Players: dropped}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWhisper(t *testing.T) {
+	g, _ := NewGame([]int{1, 2})
+	g.ConnectPlayer("Alice")
+	g.ConnectPlayer("Bob")
+	g.SwitchPlayerMap("Alice", 1)
+	alice, _ := g.GetPlayer("Alice")
+	bob, _ := g.GetPlayer("Bob")
+
+	// Bob is not in any map, and still gets the whisper.
+	assert.Nil(t, alice.Whisper("BOB", "psst"))
+	msg := <-bob.GetChannel()
+	assert.Equal(t, KindWhisper, msg.Kind)
+	assert.Equal(t, "Alice whispers: psst", msg.Text())
+
+	assert.NotNil(t, alice.Whisper("nobody", "hello?"))
+	assert.NotNil(t, alice.Whisper("alice", "talking to myself"))
+
+	g.DisconnectPlayer("Bob")
+	assert.NotNil(t, bob.Whisper("Alice", "I left"))
+}
+
+func TestBroadcastReportsDrops(t *testing.T) {
+	g, _ := NewGame([]int{1})
+	g.ConnectPlayer("Reader")
+	g.ConnectPlayer("Sleeper")
+	g.SwitchPlayerMap("Reader", 1)
+	reader, _ := g.GetPlayer("Reader")
+	<-reader.GetChannel() // welcome
+
+	// Fill Sleeper's channel: nobody reads it.
+	for i := 0; i < cap(reader.ch); i++ {
+		assert.Nil(t, g.Broadcast("filler"))
+		assert.Equal(t, "filler", (<-reader.GetChannel()).Text())
+	}
+
+	err := g.Broadcast("server restarts in 5 minutes")
+	var drop *DropError
+	assert.True(t, errors.As(err, &drop))
+	assert.Equal(t, []string{"Sleeper"}, drop.Players)
+	msg := <-reader.GetChannel()
+	assert.Equal(t, KindSystem, msg.Kind)
+	assert.Equal(t, "server restarts in 5 minutes", msg.Text())
+
+	err = reader.Whisper("Sleeper", "wake up")
+	assert.True(t, errors.As(err, &drop))
+	assert.Equal(t, "message dropped for: Sleeper", err.Error())
+}
@@ -0,0 +1,72 @@
+package main
+
+import "errors"
+
+// Errors returned by the game. Compare them with errors.Is: some are wrapped
+// with more details. ErrMapFull and ErrWrongPassword (maps.go), ErrOutOfBounds
+// and ErrBlocked (spatial.go), the errors of the Matchmaker (matchmaking.go)
+// and ErrUnknownCommand (commands.go) are defined next to their code.
+var (
+	ErrPlayerNotFound = errors.New("player not found")
+	ErrPlayerExists   = errors.New("player already exists")
+	ErrPlayerBanned   = errors.New("player is banned")
+	// ErrNotConnected is returned for a player who is not in a map, or no longer in the game.
+	ErrNotConnected = errors.New("player is not connected")
+	ErrNotInMap     = errors.New("player is not in a map")
+	ErrAlreadyInMap = errors.New("player is already in this map")
+
+	ErrMapNotFound    = errors.New("map not found")
+	ErrDuplicateMapID = errors.New("map id is duplicated")
+	ErrInvalidMapID   = errors.New("map id is invalid")
+	// ErrInvalidMapOptions is wrapped with the option at fault.
+	ErrInvalidMapOptions    = errors.New("map options are invalid")
+	ErrInvalidEvacuationMap = errors.New("invalid evacuation map")
+	// ErrMapClosed is returned when sending to a map that was removed or shut down.
+	ErrMapClosed    = errors.New("map is closed")
+	ErrGameShutDown = errors.New("game is shut down")
+
+	// ErrChannelFull is returned when a message was dropped because a map or
+	// player channel was full. A *DropError matches it too.
+	ErrChannelFull    = errors.New("channel is full")
+	ErrInputQueueFull = errors.New("input queue is full")
+
+	ErrTooFast          = errors.New("you are sending messages too fast")
+	ErrDuplicateMessage = errors.New("duplicate message")
+	// ErrMuted is matched by every *MutedError.
+	ErrMuted       = errors.New("player is muted")
+	ErrNotMuted    = errors.New("player is not muted")
+	ErrWhisperSelf = errors.New("cannot whisper to yourself")
+
+	// ErrNotAuthorized is returned when a player's role does not allow an action.
+	ErrNotAuthorized   = errors.New("not authorized")
+	ErrInvalidRole     = errors.New("invalid role")
+	ErrCannotKickAdmin = errors.New("cannot kick an admin")
+	ErrCannotBanAdmin  = errors.New("cannot ban an admin")
+	ErrNotBanned       = errors.New("player is not banned")
+
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionInUse    = errors.New("session is already in use")
+
+	ErrNodeNotFound = errors.New("node not found")
+	ErrNodeExists   = errors.New("node is already added")
+	ErrNodeClosed   = errors.New("node is closed")
+	// ErrMapOwned is returned by Router.AddNode for a map another node already serves.
+	ErrMapOwned = errors.New("map is already owned by another node")
+)
+
+// sentinelErrors are every exported error of the package. A shard node sends
+// the one an error matches along with it, so the Router can match it again
+// (see shardError).
+var sentinelErrors = []error{
+	ErrPlayerNotFound, ErrPlayerExists, ErrPlayerBanned, ErrNotConnected, ErrNotInMap, ErrAlreadyInMap,
+	ErrMapNotFound, ErrDuplicateMapID, ErrInvalidMapID, ErrInvalidMapOptions, ErrInvalidEvacuationMap,
+	ErrMapClosed, ErrGameShutDown,
+	ErrMapFull, ErrWrongPassword, ErrOutOfBounds, ErrBlocked,
+	ErrChannelFull, ErrInputQueueFull,
+	ErrTooFast, ErrDuplicateMessage, ErrMuted, ErrWhisperSelf, ErrNotMuted,
+	ErrNotAuthorized, ErrInvalidRole, ErrCannotKickAdmin, ErrCannotBanAdmin, ErrNotBanned,
+	ErrSessionNotFound, ErrSessionInUse,
+	ErrNodeNotFound, ErrNodeExists, ErrNodeClosed, ErrMapOwned,
+	ErrMatchmakerClosed, ErrAlreadyQueued, ErrNotQueued, ErrNoMatch,
+	ErrUnknownCommand,
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"context"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSentinelErrors(t *testing.T) {
+	g, err := NewGame([]int{1})
+	require.NoError(t, err)
+	_, err = NewGame([]int{1, 1})
+	assert.ErrorIs(t, err, ErrDuplicateMapID)
+	_, err = NewGame([]int{0})
+	assert.ErrorIs(t, err, ErrInvalidMapID)
+
+	require.NoError(t, g.ConnectPlayer("Alice"))
+	assert.ErrorIs(t, g.ConnectPlayer("alice"), ErrPlayerExists)
+	assert.ErrorIs(t, g.SwitchPlayerMap("Nobody", 1), ErrPlayerNotFound)
+	assert.ErrorIs(t, g.SwitchPlayerMap("Alice", 9), ErrMapNotFound)
+	alice, _ := g.GetPlayer("Alice")
+	assert.ErrorIs(t, alice.SendMessage("hi"), ErrNotConnected)
+	assert.ErrorIs(t, alice.Move(1, 0), ErrNotInMap)
+
+	require.NoError(t, g.SwitchPlayerMap("Alice", 1))
+	assert.ErrorIs(t, g.SwitchPlayerMap("Alice", 1), ErrAlreadyInMap)
+	assert.ErrorIs(t, alice.Whisper("alice", "hi"), ErrWhisperSelf)
+
+	require.NoError(t, g.Mute("", "Alice", time.Minute))
+	err = alice.SendMessage("hi")
+	assert.ErrorIs(t, err, ErrMuted)
+	var muted *MutedError
+	assert.ErrorAs(t, err, &muted)
+
+	assert.ErrorIs(t, &DropError{Players: []string{"Bob"}}, ErrChannelFull)
+	require.NoError(t, g.Unmute("", "Alice"))
+	assert.ErrorIs(t, g.Unmute("", "Alice"), ErrNotMuted)
+	assert.ErrorIs(t, g.Unban("", "Alice"), ErrNotBanned)
+	require.NoError(t, g.SetRole("", "Alice", RoleAdmin))
+	assert.ErrorIs(t, g.Kick("", "Alice", ""), ErrCannotKickAdmin)
+	assert.ErrorIs(t, g.Ban("", "Alice", 0), ErrCannotBanAdmin)
+	assert.ErrorIs(t, g.SetRole("", "Alice", Role(-1)), ErrInvalidRole)
+
+	assert.ErrorIs(t, g.AddMap(2, MapOptions{Capacity: -1}), ErrInvalidMapOptions)
+	assert.ErrorIs(t, g.AddMap(2, MapOptions{ChatRadius: -1}), ErrInvalidMapOptions)
+	err = g.AddMap(2, MapOptions{Width: 2, Height: 2, Spawn: Point{5, 5}})
+	assert.ErrorIs(t, err, ErrInvalidMapOptions)
+	assert.ErrorIs(t, err, ErrOutOfBounds)
+	assert.ErrorIs(t, g.RemoveMap(1, 1), ErrInvalidEvacuationMap)
+
+	require.NoError(t, g.Shutdown(context.Background()))
+	assert.ErrorIs(t, g.ConnectPlayer("Bob"), ErrGameShutDown)
+}
+
+// fillMapChannel connects a player to a map whose fan-out is stuck, and fills
+// the map channel. The fan-out resumes when the test ends.
+func fillMapChannel(t *testing.T, opts Options) *Player {
+	g, _ := newTestGame(t, []int{1}, opts)
+	alice := join(t, g, "Alice", 1)
+
+	m := g.maps[1]
+	m.mu.Lock()
+	t.Cleanup(m.mu.Unlock)
+	require.Eventually(t, func() bool {
+		m.enqueue(context.Background(), g.newMessage("", 1, KindSystem, "filler"), false)
+		return len(m.ch) == cap(m.ch)
+	}, 2*time.Second, time.Millisecond)
+	return alice
+}
+
+func TestSendMessageChannelFull(t *testing.T) {
+	alice := fillMapChannel(t, Options{})
+	err := alice.SendMessage("hi")
+	assert.ErrorIs(t, err, ErrChannelFull)
+	assert.EqualError(t, err, "map channel is full")
+}
+
+func TestSendMessageContext(t *testing.T) {
+	alice := fillMapChannel(t, Options{Backpressure: BlockWithTimeout, BlockTimeout: time.Minute})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	assert.ErrorIs(t, alice.SendMessageContext(ctx, "hi"), context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 10*time.Second)
+}
+
+func TestReceive(t *testing.T) {
+	g, err := NewGame([]int{1})
+	require.NoError(t, err)
+	g.ConnectPlayer("Alice")
+	alice, _ := g.GetPlayer("Alice")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = alice.Receive(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	g.SwitchPlayerMap("Alice", 1)
+	msg, err := alice.Receive(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, "Welcome to map 1! You are the first one here.", msg.Text())
+
+	g.DisconnectPlayer("Alice")
+	_, err = alice.Receive(context.Background())
+	assert.ErrorIs(t, err, ErrNotConnected)
+}
+
+func TestRemoveMapContext(t *testing.T) {
+	g, err := NewGame([]int{1, 2})
+	require.NoError(t, err)
+	g.ConnectPlayer("Alice")
+	g.SwitchPlayerMap("Alice", 1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	require.NoError(t, g.RemoveMapContext(ctx, 1, 2))
+	_, err = g.GetMap(1)
+	assert.ErrorIs(t, err, ErrMapNotFound)
+	assert.Equal(t, []string{"Alice"}, g.maps[2].PlayerNames())
+	assert.ErrorIs(t, g.RemoveMapContext(ctx, 1, 0), ErrMapNotFound)
+}
+
+func TestTicketWait(t *testing.T) {
+	mt := newMatchTest(t, []int{1}, MatchmakerOptions{})
+	alice := mt.enqueue("Alice", MatchPreferences{})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := alice.Wait(ctx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Equal(t, 1, mt.mm.Queued())
+
+	mt.enqueue("Bob", MatchPreferences{})
+	mt.advance(time.Second)
+	m, err := alice.Wait(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 1, m.Map)
+
+	carol := mt.enqueue("Carol", MatchPreferences{})
+	require.NoError(t, mt.mm.Cancel("Carol"))
+	_, err = carol.Wait(context.Background())
+	assert.ErrorIs(t, err, ErrNoMatch)
+	assert.ErrorIs(t, mt.mm.Cancel("Carol"), ErrNotQueued)
+}
+
+func TestRouterErrors(t *testing.T) {
+	g, a := startShard(t, 1)
+	require.NoError(t, g.AddMap(2, MapOptions{Password: "secret"}))
+	r := NewRouter()
+	defer r.Close()
+	require.NoError(t, r.AddNode(a.Addr()))
+	r.ConnectPlayer("Alice")
+	require.NoError(t, r.SwitchPlayerMap("Alice", 1))
+
+	// Errors coming back from a node are the sentinels again.
+	err := r.SwitchPlayerMap("Alice", 1)
+	assert.ErrorIs(t, err, ErrAlreadyInMap)
+	assert.ErrorIs(t, r.SendMessage("Bob", "hi"), ErrPlayerNotFound)
+
+	// Wrapped errors and error types match their sentinel too, and keep their text.
+	err = r.SendMessage("Alice", "/dance")
+	assert.ErrorIs(t, err, ErrUnknownCommand)
+	assert.EqualError(t, err, "unknown command: /dance")
+	assert.ErrorIs(t, r.SwitchPlayerMapWithPassword("Alice", 2, "nope"), ErrWrongPassword)
+	require.NoError(t, g.Mute("", "Alice", time.Minute))
+	err = r.SendMessage("Alice", "hi")
+	assert.ErrorIs(t, err, ErrMuted)
+	assert.EqualError(t, err, "you are muted for 1m0s")
+	assert.ErrorIs(t, r.SwitchPlayerMap("Alice", 9), ErrMapNotFound)
+
+	// Once the welcome is read, nothing comes before the context ends.
+	pollUntil(t, r, "Alice", "Welcome to map 1! You are the first one here.")
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err = r.PollContext(ctx, "Alice", time.Minute)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+// TestSentinelErrorsComplete checks that sentinelErrors lists every exported
+// error of the package, so a Router can match any of them.
+func TestSentinelErrorsComplete(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	require.NoError(t, err)
+	var declared []string
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), name, nil, 0)
+		require.NoError(t, err)
+		ast.Inspect(f, func(n ast.Node) bool {
+			spec, ok := n.(*ast.ValueSpec)
+			if !ok {
+				return true
+			}
+			for i, name := range spec.Names {
+				if strings.HasPrefix(name.Name, "Err") && i < len(spec.Values) {
+					if call, ok := spec.Values[i].(*ast.CallExpr); ok && len(call.Args) == 1 {
+						text, _ := strconv.Unquote(call.Args[0].(*ast.BasicLit).Value)
+						declared = append(declared, text)
+					}
+				}
+			}
+			return true
+		})
+	}
+
+	var listed []string
+	for _, sentinel := range sentinelErrors {
+		listed = append(listed, sentinel.Error())
+	}
+	assert.ElementsMatch(t, declared, listed)
+}
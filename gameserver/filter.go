@@ -0,0 +1,106 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Filter checks the text of a message before it is sent. It returns the text
+// to send, possibly rewritten, or an error to reject the message; the error is
+// returned to the sender as is.
+type Filter interface {
+	Filter(sender, text string) (string, error)
+}
+
+// FilterFunc adapts a function to the Filter interface.
+type FilterFunc func(sender, text string) (string, error)
+
+func (f FilterFunc) Filter(sender, text string) (string, error) {
+	return f(sender, text)
+}
+
+// AddFilter appends f to the filter chain. Chat messages and whispers go
+// through the filters in the order they were added, each one getting the text
+// returned by the previous one.
+func (g *Game) AddFilter(f Filter) {
+	g.filterMu.Lock()
+	defer g.filterMu.Unlock()
+	g.filters = append(g.filters, f)
+}
+
+// filter runs text through the filter chain.
+func (g *Game) filter(sender, text string) (string, error) {
+	g.filterMu.RLock()
+	filters := g.filters
+	g.filterMu.RUnlock()
+
+	for _, f := range filters {
+		var err error
+		if text, err = f.Filter(sender, text); err != nil {
+			return "", err
+		}
+	}
+	return text, nil
+}
+
+// WordFilter masks a list of words with asterisks, e.g. "darn" becomes "****".
+// Words are matched whole and case-insensitively, in any script: a word is
+// made of letters, digits, combining marks and underscores.
+type WordFilter struct {
+	re *regexp.Regexp // nil when there are no words
+}
+
+// NewWordFilter creates a filter masking the given words.
+func NewWordFilter(words ...string) *WordFilter {
+	quoted := make([]string, 0, len(words))
+	for _, w := range words {
+		if w = strings.TrimSpace(w); w != "" {
+			quoted = append(quoted, regexp.QuoteMeta(w))
+		}
+	}
+	if len(quoted) == 0 {
+		return &WordFilter{}
+	}
+	// \b only knows ASCII letters, so the word boundaries are checked in Filter.
+	return &WordFilter{re: regexp.MustCompile(`(?i)(?:` + strings.Join(quoted, "|") + `)`)}
+}
+
+func (f *WordFilter) Filter(sender, text string) (string, error) {
+	if f.re == nil {
+		return text, nil
+	}
+	var b strings.Builder
+	last := 0
+	for _, loc := range f.re.FindAllStringIndex(text, -1) {
+		if !wholeWord(text, loc[0], loc[1]) {
+			continue
+		}
+		b.WriteString(text[last:loc[0]])
+		b.WriteString(strings.Repeat("*", utf8.RuneCountInString(text[loc[0]:loc[1]])))
+		last = loc[1]
+	}
+	b.WriteString(text[last:])
+	return b.String(), nil
+}
+
+// wholeWord reports whether text[i:j] is a whole word, not a part of a longer one.
+func wholeWord(text string, i, j int) bool {
+	before, _ := utf8.DecodeLastRuneInString(text[:i])
+	after, _ := utf8.DecodeRuneInString(text[j:])
+	return !isWordRune(before) && !isWordRune(after)
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r) || r == '_'
+}
+
+// screen runs the checks every message from p goes through: the anti-spam
+// checks, then the filter chain. It returns the text to send.
+func (p *Player) screen(msg string) (string, error) {
+	if err := p.allow(msg, false); err != nil {
+		return "", err
+	}
+	return p.g.filter(p.name, msg)
+}
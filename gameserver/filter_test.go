@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWordFilter(t *testing.T) {
+	f := NewWordFilter("darn", "heck", " ")
+
+	text, err := f.Filter("Alice", "Darn it, what the HECK! darning is fine")
+	assert.NoError(t, err)
+	assert.Equal(t, "**** it, what the ****! darning is fine", text)
+
+	text, _ = NewWordFilter().Filter("Alice", "darn")
+	assert.Equal(t, "darn", text)
+
+	// Word boundaries work in any script, not only with ASCII letters.
+	text, _ = NewWordFilter("بد", "Ärger").Filter("Alice", "این بد است، بدتر نه. ärger, Ärgernis")
+	assert.Equal(t, "این ** است، بدتر نه. *****, Ärgernis", text)
+}
+
+func TestFilterChain(t *testing.T) {
+	g, _ := NewGame([]int{1})
+	g.ConnectPlayer("Alice")
+	g.ConnectPlayer("Bob")
+	g.SwitchPlayerMap("Alice", 1)
+	g.SwitchPlayerMap("Bob", 1)
+	alice, _ := g.GetPlayer("Alice")
+	bob, _ := g.GetPlayer("Bob")
+	<-bob.GetChannel() // welcome
+
+	g.AddFilter(NewWordFilter("darn"))
+	g.AddFilter(FilterFunc(func(sender, text string) (string, error) {
+		if strings.Contains(text, "http://") {
+			return "", errors.New("links are not allowed")
+		}
+		return text, nil
+	}))
+	g.AddFilter(FilterFunc(func(sender, text string) (string, error) {
+		return strings.TrimSpace(text), nil
+	}))
+
+	require.NoError(t, alice.SendMessage("  darn, hi bob "))
+	assert.Equal(t, "Alice says: ****, hi bob", (<-bob.GetChannel()).Text())
+
+	assert.EqualError(t, alice.SendMessage("visit http://spam"), "links are not allowed")
+	assert.EqualError(t, alice.Whisper("Bob", "http://spam"), "links are not allowed")
+
+	require.NoError(t, alice.Whisper("Bob", "darn"))
+	assert.Equal(t, "Alice whispers: ****", (<-bob.GetChannel()).Text())
+}
+
+func TestFilterCallsGame(t *testing.T) {
+	g, _ := NewGame([]int{1})
+	g.ConnectPlayer("Alice")
+	g.ConnectPlayer("Bob")
+	alice, _ := g.GetPlayer("Alice")
+	bob, _ := g.GetPlayer("Bob")
+
+	// A filter may use the game: whispers are screened without the game lock.
+	g.AddFilter(FilterFunc(func(sender, text string) (string, error) {
+		if _, err := g.GetPlayer(sender); err != nil {
+			return "", err
+		}
+		return text, g.Broadcast(sender + " whispered")
+	}))
+	require.NoError(t, alice.Whisper("Bob", "psst"))
+	assert.Equal(t, "Alice whispered", (<-bob.GetChannel()).Text())
+	assert.Equal(t, "Alice whispers: psst", (<-bob.GetChannel()).Text())
+}
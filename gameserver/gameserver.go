@@ -1,32 +1,113 @@
 package main
 
 import (
-	"errors"
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 type Player struct {
 	name string
 	zone int
-	ch   chan string
+	ch   chan Message
 	m    *Map
+	g    *Game // the game the player is connected to
+
+	// joinedAfter is the last message ID when the player entered its map (guarded by m.mu).
+	// Messages queued in the map before that were not meant for this player.
+	joinedAfter uint64
+
+	pos   Point            // position in the map, guarded by m.mu
+	seen  map[string]Point // state of the last snapshot sent, guarded by m.mu
+	role  Role             // guarded by g.mu
+	stats counters         // messages sent by, delivered to and dropped for this player
+	spam  spamState        // rate limit, duplicate suppression and mutes
+
+	token     string // session token, see Resume
+	away      bool   // the connection was lost and the session can be resumed, guarded by g.mu
+	awayGen   uint64 // counts the absences, so an old grace timer does not expire a new one
+	awayTimer Timer  // disconnects the player when the grace window ends, guarded by g.mu
+
+	sendMu sync.RWMutex  // held for reading by blocking deliveries, see Player.close
+	closed bool          // p.ch is closed, guarded by sendMu
+	gone   chan struct{} // closed when the player is disconnected
 }
 
 type Map struct {
 	id      int
 	mu      sync.Mutex
 	players map[string]*Player
-	ch      chan string
+	ch      chan Message
+	g       *Game    // the game the map belongs to
+	history *history // recent chat, guarded by mu
+
+	capacity int           // maximum number of players, 0 for no limit
+	password string        // required to enter the map, if set
+	done     chan struct{} // closed when FanOutMessages returns
+
+	width, height int                // bounds, 0 for no limit
+	obstacles     map[Point]struct{} // positions no one can stand on
+	spawn         Point              // where players enter the map
+	chatRadius    float64            // proximity chat radius, 0 for map-wide chat
+	grid          *grid              // spatial index of the players, guarded by mu
+
+	tick   uint64        // ticks run so far, guarded by mu
+	inputs []input       // moves waiting for the next tick, guarded by mu
+	stop   chan struct{} // closed by close to end the tick loop
+
+	// sendMu guards sending on ch against Shutdown closing it: senders hold it
+	// for reading (so a blocking send does not stop FanOutMessages, which uses mu),
+	// and Shutdown holds it for writing while it closes ch.
+	sendMu sync.RWMutex
+	closed bool // set (under sendMu) when ch is closed by Shutdown or RemoveMap
+
+	stats   counters   // messages accepted, delivered and dropped by this map
+	latency *histogram // fan-out latency, see Game.WriteMetrics
 }
 
 type Game struct {
 	mu      sync.Mutex
 	players map[string]*Player
 	maps    map[int]*Map
+	closed  bool // set by Shutdown; no player can connect afterwards
+	opts    Options
+	bans    map[string]time.Time // lowercase name → end of the ban, zero for a permanent ban
+
+	filterMu sync.RWMutex
+	filters  []Filter // see AddFilter
+
+	sessions map[string]*Player // session token → player, see Resume
+
+	commandMu sync.RWMutex
+	commands  map[string]CommandHandler // command name → handler, see HandleCommand
+	pluginMu  sync.RWMutex
+	plugins   []Plugin      // see AddPlugin
+	intN      func(int) int // rand.IntN, replaced in tests for /roll
+
+	store    Store          // nil for a game without persistence, see NewGameFromStore
+	lastMaps map[string]int // lowercase name → last map of the player, guarded by mu
+	storeMu  sync.Mutex
+	storeErr error    // last error writing to the store, see StoreError
+	pending  []Record // changes waiting for flushStore, in order, guarded by storeMu
+	flushMu  sync.Mutex
+
+	log     *slog.Logger // Options.Logger
+	metrics gameMetrics  // see WriteMetrics
+
+	// fanOuts tracks the FanOutMessages goroutine of every map.
+	fanOuts sync.WaitGroup
 }
 
 func NewGame(mapIds []int) (*Game, error) {
+	return NewGameWithOptions(mapIds, Options{})
+}
+
+// NewGameWithOptions is like NewGame, with settings such as the backpressure policy.
+func NewGameWithOptions(mapIds []int, opts Options) (*Game, error) {
 	// Create an empty map to store all game maps
 	// Key: map ID (int)
 	// Value: pointer to Map struct
@@ -35,38 +116,43 @@ func NewGame(mapIds []int) (*Game, error) {
 	// Iterate through all provided map IDs
 	for _, id := range mapIds {
 
-		// Validate: map ID must be positive (greater than 0)
-		if id <= 0 {
-			return nil, errors.New("map id is invalid")
-		}
-
 		// Validate: check for duplicate map IDs
 		if _, ok := gameMaps[id]; ok {
-			return nil, errors.New("map id is duplicated")
+			return nil, ErrDuplicateMapID
 		}
 
-		// Create a new Map instance
-		m := &Map{
-			id:      id,                       // map identifier
-			players: make(map[string]*Player), // holds players currently in this map
-			ch:      make(chan string, 100),   // message channel for communication between players in this map
+		// Create a new Map instance (this also checks the map ID is positive).
+		m, err := newMap(id, MapOptions{})
+		if err != nil {
+			return nil, err
 		}
 
 		// Store the new Map in the gameMaps collection
 		gameMaps[id] = m
-
-		// Start the FanOutMessages goroutine for this map
-		// It continuously listens for new messages on m.ch
-		// and broadcasts them to all players inside this map
-		go m.FanOutMessages()
 	}
 
 	// Create the Game instance containing:
 	// - an empty player list (no one connected yet)
 	// - all initialized maps
+	opts = opts.withDefaults()
 	g := &Game{
-		players: make(map[string]*Player),
-		maps:    gameMaps,
+		players:  make(map[string]*Player),
+		maps:     make(map[int]*Map, len(gameMaps)),
+		opts:     opts,
+		log:      opts.Logger,
+		bans:     make(map[string]time.Time),
+		sessions: make(map[string]*Player),
+		commands: make(map[string]CommandHandler),
+		intN:     rand.IntN,
+	}
+	g.registerBuiltinCommands()
+
+	// Start the FanOutMessages goroutine of every map, only once all IDs are valid
+	// so that a failed NewGame does not leak goroutines.
+	// Each goroutine continuously listens for new messages on m.ch
+	// and broadcasts them to all players inside this map, until Shutdown closes m.ch.
+	for _, m := range gameMaps {
+		g.attachMap(m)
 	}
 
 	// Return the newly created Game and no error
@@ -74,62 +160,126 @@ func NewGame(mapIds []int) (*Game, error) {
 }
 
 func (g *Game) ConnectPlayer(name string) error {
+	_, err := g.connect(name)
+	return err
+}
+
+// connect is ConnectPlayer, returning the new player. Its name may differ from
+// name, since a plugin can rename it: callers must use the returned player.
+func (g *Game) connect(name string) (*Player, error) {
+	// Let the plugins veto the connection or change the name, before taking the
+	// lock: they may call the game.
+	e := &ConnectEvent{Name: name}
+	if err := g.runPlugins(func(pl Plugin) error { return pl.OnConnect(e) }); err != nil {
+		return nil, err
+	}
+	name = e.Name
+
 	// Convert player name to lowercase to make it case-insensitive.
 	// This ensures "Mamad", "mamaD", and "MAMAD" are treated as the same player.
 	key := strings.ToLower(name)
 
+	// Save the changes once the locks are released (see flushStore).
+	defer g.flushStore()
+
 	// Lock the game mutex to prevent concurrent access to g.players.
 	// Only one goroutine can modify the players map at a time.
 	g.mu.Lock()
 	defer g.mu.Unlock() // Automatically unlock when the function returns.
 
+	// No one can join a game that is shutting down.
+	if g.closed {
+		return nil, ErrGameShutDown
+	}
+
+	// Banned names are kept out until the ban ends.
+	if g.banned(key) {
+		return nil, ErrPlayerBanned
+	}
+
 	// Check if a player with the same name already exists in the game.
 	if _, ok := g.players[key]; ok {
-		return errors.New("player already exists")
+		return nil, ErrPlayerExists
 	}
 
 	// Create a new Player instance.
 	p := &Player{
-		name: name,                   // The player's display name (case preserved).
-		zone: -1,                     // -1 means the player is not in any map yet.
-		ch:   make(chan string, 100), // Buffered channel for receiving chat messages.
-		m:    nil,                    // No map assigned yet.
+		name: name,                    // The player's display name (case preserved).
+		zone: -1,                      // -1 means the player is not in any map yet.
+		ch:   make(chan Message, 100), // Buffered channel for receiving chat messages.
+		m:    nil,                     // No map assigned yet.
+		g:    g,                       // Needed for direct messages to players in other maps.
+		gone: make(chan struct{}),
+
+		token: newToken(), // Lets the client resume the session after losing its connection.
 	}
 
 	// Add the new player to the game's players map using the lowercase key.
 	g.players[key] = p
+	g.sessions[p.token] = p
+
+	// A returning player goes back to the map it was in (only for games with a store).
+	g.restorePlayer(p)
+	g.metrics.connects.Add(1)
+	g.log.Info("player connected", "player", p.name, "map", max(p.zone, 0))
 
 	// Successfully connected the player, no error to return.
-	return nil
+	return p, nil
 }
 
 func (g *Game) SwitchPlayerMap(name string, mapId int) error {
+	return g.SwitchPlayerMapWithPassword(name, mapId, "")
+}
+
+// SwitchPlayerMapWithPassword is like SwitchPlayerMap, for maps that require a password.
+// It returns ErrWrongPassword or ErrMapFull when the player cannot enter the map.
+func (g *Game) SwitchPlayerMapWithPassword(name string, mapId int, password string) error {
+	// Let the plugins veto the move or change the destination (see Plugin).
+	mapId, err := g.switchHooks(name, mapId)
+	if err != nil {
+		return err
+	}
+
 	// Normalize the name so lookups are case-insensitive.
 	key := strings.ToLower(name)
 
 	// Lock the Game while we read/modify shared structures (players/maps).
 	// This prevents concurrent goroutines from racing on g.players or g.maps.
+	// The store is written after the lock is released (see flushStore).
+	defer g.flushStore()
 	g.mu.Lock()
 	defer g.mu.Unlock() // Automatically unlock when the function ends.
 
 	// 1) Validate the destination map exists.
 	newMap, ok := g.maps[mapId]
 	if !ok {
-		return errors.New("map not found")
+		return ErrMapNotFound
 	}
 
 	// 2) Validate the player exists.
 	p, ok := g.players[key]
 	if !ok {
-		return errors.New("player not found")
+		return ErrPlayerNotFound
 	}
 
 	// 3) Short-circuit: already in that map? that's an error.
 	if p.zone == mapId {
-		return errors.New("player is already in this map")
+		return ErrAlreadyInMap
+	}
+
+	// 4) Check the player may enter: the map's password and capacity.
+	if err := newMap.checkEntry(password); err != nil {
+		return err
 	}
 
-	// 4) Find the player's current map (if any).
+	g.switchMap(p, newMap)
+	return nil
+}
+
+// switchMap moves p from its current map, if any, to newMap, which p may enter.
+// The caller must hold g.mu.
+func (g *Game) switchMap(p *Player, newMap *Map) {
+	// 5) Find the player's current map (if any).
 	// zone == -1 means the player is not in any map yet (first move).
 	// if zone == -1, the oldMap get nil value, we use it below to prevent panic.
 	var oldMap *Map
@@ -137,40 +287,43 @@ func (g *Game) SwitchPlayerMap(name string, mapId int) error {
 		oldMap = g.maps[p.zone] // safe: p.zone came from our own state
 	}
 
-	// 5) Lock the per-map mutexes in a consistent global order to avoid deadlocks.
+	// 6) Lock the per-map mutexes in a consistent global order to avoid deadlocks.
 	// If both old and new exist, lock the one with the smaller id first.
 	// If there is no old map (first move), just lock the new map.
-	if oldMap != nil && oldMap.id < newMap.id {
-		oldMap.mu.Lock()
-		newMap.mu.Lock()
+	if oldMap != nil {
+		lockMaps(oldMap, newMap)
 	} else {
 		newMap.mu.Lock()
-		if oldMap != nil {
-			oldMap.mu.Lock()
-		}
 	}
 
-	// 6) Remove the player from the old map if they had one.
+	// 7) Remove the player from the old map if they had one, and tell the players there.
 	// Important: only touch oldMap if it is non-nil (first move has no old map).
 	// Without this check, calling delete on a nil map would cause a panic.
 	if oldMap != nil {
-		delete(oldMap.players, key)
+		oldMap.leave(p)
+		oldMap.notify(leaveMessage(p, oldMap.id))
 	}
 
-	// 7) Add the player to the new map and
-	// Update both the player's zone (map ID) and its map pointer reference.
-	newMap.players[key] = p
-	p.zone = mapId
-	p.m = newMap
+	// 8) Add the player to the new map, tell the players there, and greet the
+	// player with the list of who is here and the recent chat.
+	// These are non-blocking sends done while we still hold both map locks,
+	// so no extra lock is needed and the lock order above still holds.
+	g.enterMap(p, newMap)
+	g.persistPlayer(p)
 
-	// 8) Unlock in reverse order of locking.
+	g.metrics.switches.Add(1)
+	from := 0
+	if oldMap != nil {
+		from = oldMap.id
+	}
+	g.log.Info("player switched map", "player", p.name, "from", from, "to", newMap.id)
+
+	// 9) Unlock in reverse order of locking.
 	// Again, we check for nil to avoid calling Unlock on a nil map (which would panic).
 	newMap.mu.Unlock()
 	if oldMap != nil {
 		oldMap.mu.Unlock()
 	}
-
-	return nil
 }
 
 func (g *Game) GetPlayer(name string) (*Player, error) {
@@ -180,7 +333,7 @@ func (g *Game) GetPlayer(name string) (*Player, error) {
 	p, ok := g.players[key]
 	g.mu.Unlock()
 	if !ok {
-		return nil, errors.New("player not found")
+		return nil, ErrPlayerNotFound
 	}
 	return p, nil
 }
@@ -190,86 +343,170 @@ func (g *Game) GetMap(mapId int) (*Map, error) {
 	m, ok := g.maps[mapId]
 	g.mu.Unlock()
 	if !ok {
-		return nil, errors.New("map not found")
+		return nil, ErrMapNotFound
 	}
 	return m, nil
 }
 
-func (m *Map) FanOutMessages() {
-	// Continuously read incoming packets from the map's channel.
-	// Each packet is formatted as: "<senderKey>\x00<displayMessage>"
-	for packet := range m.ch {
-		// Find the delimiter that separates sender key and message body.
-		i := strings.IndexByte(packet, '\x00')
-		if i < 0 {
-			// Malformed packet: skip safely rather than crashing.
-			continue
-		}
+// PlayerNames returns the display names of the players currently in the map, sorted.
+func (m *Map) PlayerNames() []string {
+	m.mu.Lock()
+	names := make([]string, 0, len(m.players))
+	for _, p := range m.players {
+		names = append(names, p.name)
+	}
+	m.mu.Unlock()
+
+	sort.Strings(names)
+	return names
+}
 
-		// Extract sender key (lowercase player name) and the display-ready message.
-		senderKey := packet[:i]
-		raw := packet[i+1:] // e.g., "Mamad says: salam"
+func (m *Map) FanOutMessages() {
+	// Continuously read incoming messages from the map's channel.
+	for msg := range m.ch {
+		// The sender key (lowercase player name) is "" for server messages,
+		// which therefore reach everyone.
+		senderKey := msg.senderKey()
 
 		// Lock the map while iterating over its players to avoid data races.
+		var slow, waiting []*Player
 		m.mu.Lock()
-		for key, p := range m.players {
+		// Remember the chat for players who join later (see Map.History).
+		// Proximity chat is not kept: it was not meant for everyone.
+		remember := recordable(msg) && m.chatRadius == 0
+		if remember {
+			m.history.record(msg)
+		}
+		// Only players in range get proximity chat; the grid finds them quickly.
+		for _, p := range m.audience(msg) {
+			key := strings.ToLower(p.name)
 			// Do not echo the message back to the sender.
-			// Also double-check the player still belongs to this map (defensive check).
-			if key != senderKey && p.m == m {
-				// Non-blocking send to the player's channel:
-				// - If the channel buffer has space, deliver the message.
-				// - If it's full, drop the message to prevent blocking this goroutine.
-				select {
-				case p.ch <- raw:
+			// Also double-check the player still belongs to this map (defensive check),
+			// and skip players who joined after the message was sent.
+			if key != senderKey && p.m == m && msg.ID > p.joinedAfter {
+				// Send to the player's channel following the game's backpressure policy:
+				// by default, drop the message if the channel is full, to prevent blocking this goroutine.
+				// Never wait while holding the map lock: BlockWithTimeout waits below.
+				switch {
+				case m.g.opts.Backpressure == BlockWithTimeout && len(p.ch) == cap(p.ch):
+					waiting = append(waiting, p)
+				case p.deliver(msg, false):
+					m.stats.delivered.Add(1)
 				default:
-					// Drop when the receiver is slow; keeps fan-out loop responsive.
+					m.stats.dropped.Add(1)
+					slow = append(slow, p)
 				}
 			}
 		}
 		m.mu.Unlock()
+
+		// Save it once the map is unlocked: a FileStore writes to disk. This
+		// goroutine is the only one saving the map's messages, so they stay in order.
+		if remember {
+			m.g.persist(Record{Op: OpMessage, Message: &msg})
+		}
+
+		// Wait for room in the channels that were full, without any lock held,
+		// so a stalled client only delays this map's messages.
+		for _, p := range waiting {
+			if p.deliver(msg, true) {
+				m.stats.delivered.Add(1)
+			} else {
+				m.stats.dropped.Add(1)
+			}
+		}
+		// From the creation of the message until every player got it.
+		m.latency.observe(time.Since(msg.Time).Seconds())
+
+		// Disconnecting needs the game lock, which must not be taken while holding the map lock.
+		if m.g.opts.Backpressure == DisconnectSlow {
+			for _, p := range slow {
+				m.g.disconnect(p)
+			}
+		}
 	}
 }
 
-func (p *Player) GetChannel() <-chan string {
+func (p *Player) GetChannel() <-chan Message {
 
 	return p.ch
 }
 
+// Receive waits for the next message of the player. It returns ErrNotConnected
+// once the player is disconnected and its messages are all read, or ctx.Err()
+// if ctx ends first.
+func (p *Player) Receive(ctx context.Context) (Message, error) {
+	select {
+	case msg, ok := <-p.ch:
+		if !ok {
+			return Message{}, ErrNotConnected
+		}
+		return msg, nil
+	case <-ctx.Done():
+		return Message{}, ctx.Err()
+	}
+}
+
 func (p *Player) SendMessage(msg string) error {
-	// A player must be connected to a map to send a message.
-	// If p.m is nil, the player hasn't joined any map yet.
-	if p.m == nil {
-		return errors.New("player is not connected")
+	return p.SendMessageContext(context.Background(), msg)
+}
+
+// SendMessageContext is like SendMessage. With the BlockWithTimeout policy,
+// it stops waiting for room in the map's channel when ctx ends, and returns ctx.Err().
+//
+// A message starting with a slash is a command, like "/who" (see HandleCommand);
+// start it with two slashes to send it as chat: "//help" sends "/help".
+func (p *Player) SendMessageContext(ctx context.Context, msg string) error {
+	// Reject spam before anything else (rate limit, duplicates, mutes).
+	// Commands count against the rate limit too, or /me and /roll could flood the map.
+	cmd, isCommand := parseCommand(p, msg)
+	if err := p.allow(msg, isCommand); err != nil {
+		return err
+	}
+	if isCommand {
+		return p.g.runCommand(ctx, cmd)
 	}
+	msg = strings.TrimPrefix(msg, "/")
+	return p.say(ctx, KindChat, msg)
+}
 
-	// Convert player's name to lowercase for internal use.
-	lower := strings.ToLower(p.name)
+// say sends a chat message or an action from the player to its map.
+// The caller has done the anti-spam checks.
+func (p *Player) say(ctx context.Context, kind MessageKind, msg string) error {
+	// A player must be connected to a map to send a message.
+	// If p.m is nil, the player hasn't joined any map yet (or was disconnected).
+	// Read it once under the game lock, since switchMap and removePlayer
+	// write it while the player is moved or disconnected concurrently.
+	p.g.mu.Lock()
+	m := p.m
+	p.g.mu.Unlock()
+	if m == nil {
+		return ErrNotConnected
+	}
 
-	// Build a display-friendly name: first letter uppercase, rest lowercase.
-	display := ""
-	if len(lower) > 0 {
-		display = strings.ToUpper(lower[:1]) + lower[1:]
+	// Run the text through the filter chain, which may rewrite it.
+	msg, err := p.g.filter(p.name, msg)
+	if err != nil {
+		return err
 	}
 
-	// Create the final text that other players will see.
-	// Example: "Mamad says: hello"
-	raw := display + " says: " + msg
+	// Then the plugins, which may rewrite it too.
+	e := &MessageEvent{Player: p.name, Map: m.id, Kind: kind, Text: msg}
+	if err := p.g.runPlugins(func(pl Plugin) error { return pl.OnMessage(e) }); err != nil {
+		return err
+	}
 
-	// Prepare the message packet.
-	// Format: "<senderKey>\x00<displayMessage>"
-	// Example: "mamad\x00Mamad says: hello"
-	packet := strings.ToLower(p.name) + "\x00" + raw
+	// Wrap the text in a message; other players see it as "Mamad says: hello",
+	// or "* Mamad waves" for an action, through Message.Text.
+	packet := p.g.newMessage(p.name, m.id, kind, e.Text)
 
-	// Try to send the packet into the map's channel.
-	// Use a non-blocking select to avoid freezing if the map channel is full.
-	select {
-	case p.m.ch <- packet:
-		// Successfully sent.
-		return nil
-	default:
-		// Map's channel buffer (100 messages) is full.
-		return errors.New("map channel is full")
+	// Try to send the packet into the map's channel, following the game's
+	// backpressure policy when the channel buffer (100 messages) is full.
+	if err := m.enqueue(ctx, packet, true); err != nil {
+		return err
 	}
+	p.stats.sent.Add(1)
+	return nil
 }
 
 func (p *Player) GetName() string {
@@ -2,6 +2,7 @@ package main
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -31,3 +32,30 @@ func TestSampleGetPlayer(t *testing.T) {
 	assert.Nil(t, err)
 	assert.NotNil(t, p)
 }
+
+func TestSendWhileSwitching(t *testing.T) {
+	// The system clock takes no lock, unlike manualClock, which would order
+	// the two goroutines and hide a race.
+	g, _ := NewGame([]int{1, 2})
+	assert.NoError(t, g.ConnectPlayer("Cyn"))
+	assert.NoError(t, g.SwitchPlayerMap("Cyn", 1))
+	cyn, _ := g.GetPlayer("Cyn")
+
+	// Sending reads the player's map while switching writes it: run both at
+	// once so that the race detector sees any unguarded access.
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 50; i++ {
+			cyn.SendMessage("hello")
+		}
+	}()
+	for i := 0; i < 50; i++ {
+		assert.NoError(t, g.SwitchPlayerMap("Cyn", 2-i%2))
+	}
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("SendMessage did not return")
+	}
+}
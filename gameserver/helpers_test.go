@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newTestGame creates a game with the given maps and options, running on a
+// manualClock set to 2024-01-01 12:00 UTC. It replaces any Clock in opts.
+func newTestGame(t *testing.T, mapIds []int, opts Options) (*Game, *manualClock) {
+	t.Helper()
+	clock := &manualClock{t: time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)}
+	opts.Clock = clock
+	g, err := NewGameWithOptions(mapIds, opts)
+	require.NoError(t, err)
+	return g, clock
+}
+
+// join connects name and puts them in mapId. It reads their welcome and
+// replayed messages, and the "joined" notice of the players already in the
+// map, so that every channel involved starts empty.
+func join(t *testing.T, g *Game, name string, mapId int) *Player {
+	t.Helper()
+	var others []*Player
+	for _, other := range g.maps[mapId].PlayerNames() {
+		p, err := g.GetPlayer(other)
+		require.NoError(t, err)
+		others = append(others, p)
+	}
+
+	require.NoError(t, g.ConnectPlayer(name))
+	require.NoError(t, g.SwitchPlayerMap(name, mapId))
+	p, err := g.GetPlayer(name)
+	require.NoError(t, err)
+	// The welcome and the replay are delivered before SwitchPlayerMap returns.
+	for len(p.ch) > 0 {
+		<-p.ch
+	}
+	for _, other := range others {
+		require.Equal(t, KindJoin, receive(t, other).Kind)
+	}
+	return p
+}
+
+// receive returns the next message of p, failing the test if none comes.
+func receive(t *testing.T, p *Player) Message {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	msg, err := p.Receive(ctx)
+	require.NoError(t, err)
+	return msg
+}
+
+// nextSnapshot returns the next snapshot in p's channel, skipping other messages.
+func nextSnapshot(t *testing.T, p *Player) *Snapshot {
+	t.Helper()
+	for {
+		if msg := receive(t, p); msg.Kind == KindSnapshot {
+			return msg.Snapshot
+		}
+	}
+}
+
+// manualClock is a Clock whose tickers and timers only fire when the test advances it.
+type manualClock struct {
+	mu      sync.Mutex
+	t       time.Time
+	tickers []*manualTicker
+	timers  []*manualTimer
+}
+
+type manualTimer struct {
+	at      time.Time
+	f       func()
+	stopped bool // guarded by the clock's mu
+	clock   *manualClock
+}
+
+func (c *manualClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &manualTimer{at: c.t.Add(d), f: f, clock: c}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (t *manualTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	wasActive := !t.stopped
+	t.stopped = true
+	return wasActive
+}
+
+type manualTicker struct {
+	d       time.Duration
+	next    time.Time
+	c       chan time.Time
+	stopped chan struct{}
+}
+
+func (c *manualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *manualClock) NewTicker(d time.Duration) Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &manualTicker{d: d, next: c.t.Add(d), c: make(chan time.Time), stopped: make(chan struct{})}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+func (t *manualTicker) C() <-chan time.Time { return t.c }
+func (t *manualTicker) Stop()               { close(t.stopped) }
+
+// waitTickers waits until n tickers were created.
+func (c *manualClock) waitTickers(t *testing.T, n int) {
+	require.Eventually(t, func() bool {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return len(c.tickers) >= n
+	}, 2*time.Second, time.Millisecond)
+}
+
+// advance moves the clock forward, firing every tick and timer that falls due.
+// Each tick waits until the ticker's owner received it, and timer functions
+// run before advance returns.
+func (c *manualClock) advance(d time.Duration) {
+	c.mu.Lock()
+	c.t = c.t.Add(d)
+	now := c.t
+	tickers := append([]*manualTicker(nil), c.tickers...)
+	var due []func()
+	for _, t := range c.timers {
+		if !t.stopped && !t.at.After(now) {
+			t.stopped = true
+			due = append(due, t.f)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, f := range due {
+		f()
+	}
+
+	for _, t := range tickers {
+		for !t.next.After(now) {
+			select {
+			case t.c <- t.next:
+			case <-t.stopped:
+			}
+			t.next = t.next.Add(t.d)
+		}
+	}
+}
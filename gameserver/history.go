@@ -0,0 +1,115 @@
+package main
+
+import "time"
+
+// history is a bounded ring buffer of the recent chat of a map, ordered by message ID.
+// It is guarded by the map lock.
+type history struct {
+	buf    []Message // ring storage, len(buf) is the capacity
+	start  int       // index of the oldest message
+	n      int       // number of messages stored
+	maxAge time.Duration
+	clock  Clock // the game's clock, which maxAge is measured with
+}
+
+func newHistory(size int, maxAge time.Duration, clock Clock) *history {
+	return &history{buf: make([]Message, size), maxAge: maxAge, clock: clock}
+}
+
+// at returns the i-th oldest stored message.
+func (h *history) at(i int) *Message {
+	return &h.buf[(h.start+i)%len(h.buf)]
+}
+
+// record stores msg, evicting the oldest message when the buffer is full.
+// Messages can reach FanOutMessages slightly out of ID order (two senders
+// racing), so msg is moved back to its place to keep IDs increasing.
+func (h *history) record(msg Message) {
+	if len(h.buf) == 0 {
+		return
+	}
+	if h.n == len(h.buf) {
+		h.start = (h.start + 1) % len(h.buf)
+		h.n--
+	}
+	h.n++
+	i := h.n - 1
+	for ; i > 0 && h.at(i-1).ID > msg.ID; i-- {
+		*h.at(i) = *h.at(i - 1)
+	}
+	*h.at(i) = msg
+}
+
+// prune drops the messages older than maxAge.
+func (h *history) prune(now time.Time) {
+	if h.maxAge <= 0 {
+		return
+	}
+	for h.n > 0 && now.Sub(h.at(0).Time) > h.maxAge {
+		*h.at(0) = Message{}
+		h.start = (h.start + 1) % len(h.buf)
+		h.n--
+	}
+}
+
+// since returns up to limit messages with an ID greater than since, oldest first,
+// and whether more messages follow them. A limit <= 0 means no limit.
+func (h *history) since(since uint64, limit int) ([]Message, bool) {
+	h.prune(h.clock.Now())
+	first := 0
+	for first < h.n && h.at(first).ID <= since {
+		first++
+	}
+	count := h.n - first
+	more := false
+	if limit > 0 && count > limit {
+		count, more = limit, true
+	}
+	msgs := make([]Message, 0, count)
+	for i := first; i < first+count; i++ {
+		msgs = append(msgs, *h.at(i))
+	}
+	return msgs, more
+}
+
+// last returns the n most recent messages, oldest first.
+func (h *history) last(n int) []Message {
+	h.prune(h.clock.Now())
+	if n > h.n {
+		n = h.n
+	}
+	msgs := make([]Message, 0, n)
+	for i := h.n - n; i < h.n; i++ {
+		msgs = append(msgs, *h.at(i))
+	}
+	return msgs
+}
+
+// recordable reports whether msg belongs in the chat history. Join and leave
+// notices are left out: they are about who is here now, not what was said.
+func recordable(msg Message) bool {
+	return msg.Kind == KindChat || msg.Kind == KindEmote
+}
+
+// History returns up to limit of the map's recent chat messages with an ID greater
+// than since, oldest first, and whether more messages follow. A limit <= 0 means no limit.
+//
+// To page through the whole history, start with since = 0 and pass the ID of
+// the last message received as since for the next page, until more is false.
+func (m *Map) History(since uint64, limit int) (msgs []Message, more bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.history.since(since, limit)
+}
+
+// replay sends p the last messages of the history, as configured by Options.HistoryReplay.
+// The caller must hold m.mu.
+func (m *Map) replay(p *Player) {
+	n := m.g.opts.HistoryReplay
+	if n <= 0 {
+		return
+	}
+	for _, msg := range m.history.last(n) {
+		p.deliver(msg, false)
+	}
+}
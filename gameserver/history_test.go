@@ -0,0 +1,149 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func ids(msgs []Message) []uint64 {
+	out := make([]uint64, 0, len(msgs))
+	for _, msg := range msgs {
+		out = append(out, msg.ID)
+	}
+	return out
+}
+
+func TestHistoryRing(t *testing.T) {
+	h := newHistory(3, 0, systemClock{})
+	for _, id := range []uint64{1, 2, 4, 3, 5} {
+		h.record(Message{ID: id, Time: time.Now()})
+	}
+
+	// 1 and 2 were pushed out, and 3 was put back in order.
+	msgs, more := h.since(0, 0)
+	assert.Equal(t, []uint64{3, 4, 5}, ids(msgs))
+	assert.False(t, more)
+	assert.Equal(t, []uint64{4, 5}, ids(h.last(2)))
+	assert.Equal(t, []uint64{3, 4, 5}, ids(h.last(10)))
+
+	msgs, more = h.since(3, 1)
+	assert.Equal(t, []uint64{4}, ids(msgs))
+	assert.True(t, more)
+	msgs, more = h.since(5, 1)
+	assert.Empty(t, msgs)
+	assert.False(t, more)
+
+	// A disabled history stores nothing.
+	off := newHistory(0, 0, systemClock{})
+	off.record(Message{ID: 1})
+	assert.Empty(t, off.last(1))
+}
+
+func TestHistoryMaxAge(t *testing.T) {
+	g, clock := newTestGame(t, []int{1}, Options{HistoryMaxAge: time.Minute})
+	alice := join(t, g, "Alice", 1)
+	m := g.maps[1]
+	sent := func(n int) func() bool {
+		return func() bool {
+			msgs, _ := m.History(0, 0)
+			return len(msgs) == n
+		}
+	}
+
+	require.NoError(t, alice.SendMessage("old"))
+	require.Eventually(t, sent(1), 2*time.Second, time.Millisecond)
+	clock.advance(30 * time.Second)
+	require.NoError(t, alice.SendMessage("new"))
+	require.Eventually(t, sent(2), 2*time.Second, time.Millisecond)
+
+	// Ages are measured with the game's clock: "old" expires after a minute
+	// on it, "new" 30 seconds later.
+	clock.advance(30 * time.Second)
+	msgs, _ := m.History(0, 0)
+	require.Len(t, msgs, 2)
+	clock.advance(time.Second)
+	msgs, _ = m.History(0, 0)
+	require.Len(t, msgs, 1)
+	assert.Equal(t, "new", msgs[0].Body)
+	assert.Equal(t, clock.Now().Add(-31*time.Second), msgs[0].Time)
+	clock.advance(30 * time.Second)
+	assert.Empty(t, m.history.last(10))
+}
+
+func TestMapHistoryPagination(t *testing.T) {
+	g, _ := NewGame([]int{1})
+	g.ConnectPlayer("Alice")
+	g.SwitchPlayerMap("Alice", 1)
+	alice, _ := g.GetPlayer("Alice")
+	for _, text := range []string{"one", "two", "three", "four", "five"} {
+		require.NoError(t, alice.SendMessage(text))
+	}
+	m := g.maps[1]
+	assert.Eventually(t, func() bool {
+		msgs, _ := m.History(0, 0)
+		return len(msgs) == 5
+	}, 2*time.Second, 5*time.Millisecond)
+
+	// Page through two messages at a time; the join notice is not part of the history.
+	var bodies []string
+	var since uint64
+	for pages := 1; ; pages++ {
+		msgs, more := m.History(since, 2)
+		for _, msg := range msgs {
+			bodies = append(bodies, msg.Body)
+		}
+		since = msgs[len(msgs)-1].ID
+		if !more {
+			assert.Equal(t, 3, pages)
+			break
+		}
+	}
+	assert.Equal(t, []string{"one", "two", "three", "four", "five"}, bodies)
+}
+
+func TestHistoryReplayOnJoin(t *testing.T) {
+	g, _ := NewGameWithOptions([]int{1}, Options{HistoryReplay: 2})
+	g.ConnectPlayer("Alice")
+	g.ConnectPlayer("Bob")
+	g.SwitchPlayerMap("Alice", 1)
+	alice, _ := g.GetPlayer("Alice")
+	for _, text := range []string{"one", "two", "three"} {
+		require.NoError(t, alice.SendMessage(text))
+	}
+	assert.Eventually(t, func() bool {
+		msgs, _ := g.maps[1].History(0, 0)
+		return len(msgs) == 3
+	}, 2*time.Second, 5*time.Millisecond)
+
+	// Bob gets the welcome, then the last two messages.
+	g.SwitchPlayerMap("Bob", 1)
+	bob, _ := g.GetPlayer("Bob")
+	assert.Equal(t, KindSystem, (<-bob.GetChannel()).Kind)
+	assert.Equal(t, "Alice says: two", (<-bob.GetChannel()).Text())
+	assert.Equal(t, "Alice says: three", (<-bob.GetChannel()).Text())
+
+	require.NoError(t, alice.SendMessage("live"))
+	assert.Equal(t, "Alice says: live", (<-bob.GetChannel()).Text())
+}
+
+func TestHistoryReplayDisabled(t *testing.T) {
+	g, _ := NewGameWithOptions([]int{1}, Options{HistoryReplay: -1})
+	g.ConnectPlayer("Alice")
+	g.ConnectPlayer("Bob")
+	g.SwitchPlayerMap("Alice", 1)
+	alice, _ := g.GetPlayer("Alice")
+	require.NoError(t, alice.SendMessage("before"))
+	assert.Eventually(t, func() bool {
+		msgs, _ := g.maps[1].History(0, 0)
+		return len(msgs) == 1
+	}, 2*time.Second, 5*time.Millisecond)
+
+	g.SwitchPlayerMap("Bob", 1)
+	bob, _ := g.GetPlayer("Bob")
+	assert.Equal(t, KindSystem, (<-bob.GetChannel()).Kind)
+	require.NoError(t, alice.SendMessage("after"))
+	assert.Equal(t, "Alice says: after", (<-bob.GetChannel()).Text())
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// startFanOut runs the FanOutMessages goroutine of m, and its tick loop if the
+// game has one, and tracks them for Shutdown. m.done is closed once both returned.
+func (g *Game) startFanOut(m *Map) {
+	g.fanOuts.Add(1)
+	go func() {
+		defer g.fanOuts.Done()
+		defer close(m.done)
+
+		var ticks sync.WaitGroup
+		if g.opts.TickRate > 0 {
+			ticks.Add(1)
+			go func() {
+				defer ticks.Done()
+				m.tickLoop()
+			}()
+		}
+		m.FanOutMessages()
+		ticks.Wait()
+	}()
+}
+
+// DisconnectPlayer removes a player from its map and from the game, and closes
+// its channel. Afterwards the name is free to connect again.
+func (g *Game) DisconnectPlayer(name string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p, ok := g.players[strings.ToLower(name)]
+	if !ok {
+		return ErrPlayerNotFound
+	}
+	g.removePlayer(p)
+	return nil
+}
+
+// disconnect is like DisconnectPlayer, but only removes this exact player:
+// front-ends use it so that closing an old connection never removes a new
+// player that reconnected with the same name.
+func (g *Game) disconnect(p *Player) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.players[strings.ToLower(p.name)] != p {
+		return ErrPlayerNotFound
+	}
+	g.removePlayer(p)
+	return nil
+}
+
+// removePlayer removes p from the game and its map and closes its channel.
+// The caller must hold g.mu.
+func (g *Game) removePlayer(p *Player) {
+	key := strings.ToLower(p.name)
+
+	// 1) Remove the player from the game, so no one can find it anymore,
+	// and end its session.
+	delete(g.players, key)
+	g.endSession(p)
+	g.metrics.disconnects.Add(1)
+	g.log.Info("player disconnected", "player", p.name, "map", max(p.zone, 0))
+
+	// 2) Remove it from its map and close its channel while holding the map lock.
+	// FanOutMessages only sends to players it finds in m.players, and it holds
+	// the same lock while sending, so it can never send on the closed channel.
+	if m := p.m; m != nil {
+		m.mu.Lock()
+		m.leave(p)
+		m.notify(leaveMessage(p, m.id))
+		p.zone = -1
+		p.m = nil
+		p.close()
+		m.mu.Unlock()
+	} else {
+		p.close()
+	}
+}
+
+// Shutdown stops the game: no new player can connect, every map channel is
+// closed so its FanOutMessages goroutine returns, and every player is
+// disconnected once those goroutines finished. It returns ctx.Err() if ctx
+// ends before all goroutines are done.
+func (g *Game) Shutdown(ctx context.Context) error {
+	// 1) Close every map channel, under its send lock so that no one sends on a closed channel.
+	g.mu.Lock()
+	if !g.closed {
+		g.closed = true
+		for _, m := range g.maps {
+			m.close()
+		}
+	}
+	g.mu.Unlock()
+
+	// 2) Wait for the fan-out goroutines to drain their channels and return.
+	done := make(chan struct{})
+	go func() {
+		g.fanOuts.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	// 3) Disconnect everyone, which closes their channels and ends their readers.
+	g.mu.Lock()
+	for _, p := range g.players {
+		g.removePlayer(p)
+	}
+	g.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDisconnectPlayer(t *testing.T) {
+	g, _ := NewGame([]int{1})
+	assert.Nil(t, g.ConnectPlayer("Cyn"))
+	assert.Nil(t, g.SwitchPlayerMap("Cyn", 1))
+	p, _ := g.GetPlayer("Cyn")
+
+	assert.Nil(t, g.DisconnectPlayer("cyn"))
+	for range p.GetChannel() {
+		// Drain the welcome message; the loop ends because the channel is closed.
+	}
+	m, _ := g.GetMap(1)
+	assert.Empty(t, m.PlayerNames())
+	_, err := g.GetPlayer("Cyn")
+	assert.NotNil(t, err)
+	assert.NotNil(t, g.DisconnectPlayer("Cyn"))
+	assert.NotNil(t, p.SendMessage("still here?"))
+
+	// The name is free again.
+	assert.Nil(t, g.ConnectPlayer("CYN"))
+}
+
+func TestDisconnectDuringFanOut(t *testing.T) {
+	g, _ := NewGame([]int{1})
+	g.ConnectPlayer("Talker")
+	g.SwitchPlayerMap("Talker", 1)
+	talker, _ := g.GetPlayer("Talker")
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 2000; i++ {
+			talker.SendMessage("spam")
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		name := fmt.Sprintf("listener%d", i)
+		g.ConnectPlayer(name)
+		g.SwitchPlayerMap(name, 1)
+		assert.Nil(t, g.DisconnectPlayer(name))
+	}
+	wg.Wait()
+}
+
+func TestShutdown(t *testing.T) {
+	g, _ := NewGame([]int{1, 2})
+	g.ConnectPlayer("Alice")
+	g.SwitchPlayerMap("Alice", 1)
+	g.ConnectPlayer("Bob")
+	g.SwitchPlayerMap("Bob", 1)
+	alice, _ := g.GetPlayer("Alice")
+	bob, _ := g.GetPlayer("Bob")
+	assert.Nil(t, alice.SendMessage("bye all"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	assert.Nil(t, g.Shutdown(ctx))
+
+	// Messages already queued are still delivered before the channels close.
+	var texts []string
+	for msg := range bob.GetChannel() {
+		texts = append(texts, msg.Text())
+	}
+	assert.Contains(t, texts, "Alice says: bye all")
+
+	assert.NotNil(t, g.ConnectPlayer("Carol"))
+	assert.NotNil(t, alice.SendMessage("anyone?"))
+	assert.Nil(t, g.Shutdown(ctx), "Shutdown can be called twice")
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+var (
+	// ErrMapFull is returned when a player tries to enter a map at capacity.
+	ErrMapFull = errors.New("map is full")
+	// ErrWrongPassword is returned when a player gives the wrong password of a map.
+	ErrWrongPassword = errors.New("wrong map password")
+)
+
+// MapOptions configures a map created with Game.AddMap.
+type MapOptions struct {
+	// Capacity is the maximum number of players in the map. Zero means no limit.
+	Capacity int
+	// Password, when set, must be given to SwitchPlayerMapWithPassword to enter the map.
+	Password string
+
+	// Width and Height bound the positions in the map: 0 <= X < Width and
+	// 0 <= Y < Height. Zero means no limit on that side.
+	Width, Height int
+	// Obstacles are positions no player can stand on.
+	Obstacles []Point
+	// Spawn is where players appear when they enter the map.
+	Spawn Point
+	// ChatRadius turns on proximity chat: chat messages only reach the players
+	// at most that far from the sender. Zero means map-wide chat.
+	ChatRadius float64
+}
+
+// newMap creates a map that is not attached to a game yet (see attachMap).
+func newMap(id int, opts MapOptions) (*Map, error) {
+	if id <= 0 {
+		return nil, ErrInvalidMapID
+	}
+	if opts.Capacity < 0 {
+		return nil, fmt.Errorf("%w: negative capacity", ErrInvalidMapOptions)
+	}
+	if opts.Width < 0 || opts.Height < 0 || !validRadius(opts.ChatRadius) {
+		return nil, fmt.Errorf("%w: negative size or invalid chat radius", ErrInvalidMapOptions)
+	}
+
+	// Cells as large as the chat radius keep proximity lookups to a few cells.
+	cellSize := defaultCellSize
+	if opts.ChatRadius > 0 {
+		cellSize = int(math.Min(math.Ceil(opts.ChatRadius), math.MaxInt32))
+	}
+	m := &Map{
+		id:         id,                       // map identifier
+		players:    make(map[string]*Player), // holds players currently in this map
+		ch:         make(chan Message, 100),  // message channel for communication between players in this map
+		capacity:   opts.Capacity,
+		password:   opts.Password,
+		done:       make(chan struct{}),
+		stop:       make(chan struct{}),
+		width:      opts.Width,
+		height:     opts.Height,
+		obstacles:  make(map[Point]struct{}, len(opts.Obstacles)),
+		spawn:      opts.Spawn,
+		chatRadius: opts.ChatRadius,
+		grid:       newGrid(cellSize),
+		latency:    newHistogram(latencyBuckets),
+	}
+	for _, pt := range opts.Obstacles {
+		m.obstacles[pt] = struct{}{}
+	}
+	if err := m.checkPosition(m.spawn); err != nil {
+		return nil, fmt.Errorf("%w: spawn point: %w", ErrInvalidMapOptions, err)
+	}
+	return m, nil
+}
+
+// attachMap makes m part of g and starts its FanOutMessages goroutine.
+// The caller must hold g.mu, or be the only one to know g.
+func (g *Game) attachMap(m *Map) {
+	m.g = g
+	m.history = newHistory(g.opts.HistorySize, g.opts.HistoryMaxAge, g.opts.Clock)
+	g.maps[m.id] = m
+	g.startFanOut(m)
+}
+
+// close closes the map's channel, which ends its FanOutMessages goroutine once
+// the queued messages are delivered, and stops its tick loop. It is safe to call more than once.
+func (m *Map) close() {
+	m.sendMu.Lock()
+	defer m.sendMu.Unlock()
+	if !m.closed {
+		m.closed = true
+		close(m.ch)
+		close(m.stop)
+	}
+}
+
+// AddMap adds a map to a running game.
+func (g *Game) AddMap(id int, opts MapOptions) error {
+	m, err := newMap(id, opts)
+	if err != nil {
+		return err
+	}
+
+	defer g.flushStore()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return ErrGameShutDown
+	}
+	if _, ok := g.maps[id]; ok {
+		return ErrDuplicateMapID
+	}
+	g.attachMap(m)
+	g.queue(Record{Op: OpMap, Map: id, MapOptions: &opts})
+	return nil
+}
+
+// RemoveMap removes a map from a running game. Its players are moved to the
+// map evacuateTo, whatever its capacity and password, or out of any map if
+// evacuateTo is 0. RemoveMap returns once the map's FanOutMessages goroutine
+// and tick loop have stopped.
+func (g *Game) RemoveMap(id, evacuateTo int) error {
+	return g.RemoveMapContext(context.Background(), id, evacuateTo)
+}
+
+// RemoveMapContext is like RemoveMap, but stops waiting for the goroutines of
+// the map when ctx ends, and returns ctx.Err(). The map is removed anyway.
+func (g *Game) RemoveMapContext(ctx context.Context, id, evacuateTo int) error {
+	g.mu.Lock()
+	m, ok := g.maps[id]
+	if !ok {
+		g.mu.Unlock()
+		return ErrMapNotFound
+	}
+	var dest *Map
+	if evacuateTo != 0 {
+		if dest, ok = g.maps[evacuateTo]; !ok || dest == m {
+			g.mu.Unlock()
+			return ErrInvalidEvacuationMap
+		}
+	}
+
+	// 1) Forget the map, so no one can enter it anymore.
+	delete(g.maps, id)
+	g.queue(Record{Op: OpUnmap, Map: id})
+
+	// 2) Move its players out, holding the map locks in the usual id order.
+	if dest != nil {
+		lockMaps(m, dest)
+	} else {
+		m.mu.Lock()
+	}
+	for _, p := range m.players {
+		m.leave(p)
+		p.deliver(g.newMessage("", 0, KindSystem, fmt.Sprintf("Map %d was closed", id)), false)
+		if dest != nil {
+			g.enterMap(p, dest)
+		} else {
+			p.zone = -1
+			p.m = nil
+		}
+		g.persistPlayer(p)
+	}
+	m.mu.Unlock()
+	if dest != nil {
+		dest.mu.Unlock()
+	}
+	g.mu.Unlock()
+	g.flushStore()
+
+	// 3) Stop the fan-out and the tick loop. Wait without g.mu: the goroutine may need it to
+	// disconnect slow players while it drains the channel.
+	m.close()
+	select {
+	case <-m.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// lockMaps locks two different maps in a consistent global order (smaller id
+// first) to avoid deadlocks.
+func lockMaps(a, b *Map) {
+	if a.id < b.id {
+		a.mu.Lock()
+		b.mu.Lock()
+	} else {
+		b.mu.Lock()
+		a.mu.Lock()
+	}
+}
+
+// enterMap puts p in m, tells the players there and greets p.
+// The caller must hold g.mu and m.mu, and have removed p from its previous map.
+func (g *Game) enterMap(p *Player, m *Map) {
+	m.players[strings.ToLower(p.name)] = p
+	m.place(p)
+	p.seen = nil // the next snapshot is a full one
+	p.zone = m.id
+	p.m = m
+	p.joinedAfter = lastMessageID.Load()
+
+	m.notify(joinMessage(p, m.id))
+	m.welcome(p)
+	m.replay(p)
+}
+
+// checkEntry enforces the capacity and the password of m for a player entering it.
+// The caller must hold g.mu: m.players only changes under it.
+func (m *Map) checkEntry(password string) error {
+	if m.password != "" && password != m.password {
+		return ErrWrongPassword
+	}
+	if m.capacity > 0 && len(m.players) >= m.capacity {
+		return ErrMapFull
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAddMap(t *testing.T) {
+	g, _ := NewGame([]int{1})
+	g.ConnectPlayer("Alice")
+
+	assert.NoError(t, g.AddMap(2, MapOptions{}))
+	assert.EqualError(t, g.AddMap(2, MapOptions{}), "map id is duplicated")
+	assert.EqualError(t, g.AddMap(0, MapOptions{}), "map id is invalid")
+	assert.EqualError(t, g.AddMap(3, MapOptions{Capacity: -1}), "map options are invalid: negative capacity")
+
+	// The new map works like the others.
+	g.ConnectPlayer("Bob")
+	require.NoError(t, g.SwitchPlayerMap("Alice", 2))
+	require.NoError(t, g.SwitchPlayerMap("Bob", 2))
+	alice, _ := g.GetPlayer("Alice")
+	bob, _ := g.GetPlayer("Bob")
+	<-bob.GetChannel() // welcome
+	require.NoError(t, alice.SendMessage("hello"))
+	assert.Equal(t, "Alice says: hello", (<-bob.GetChannel()).Text())
+}
+
+func TestMapCapacityAndPassword(t *testing.T) {
+	g, _ := NewGame([]int{1})
+	require.NoError(t, g.AddMap(2, MapOptions{Capacity: 1, Password: "secret"}))
+	g.ConnectPlayer("Alice")
+	g.ConnectPlayer("Bob")
+
+	assert.ErrorIs(t, g.SwitchPlayerMap("Alice", 2), ErrWrongPassword)
+	assert.ErrorIs(t, g.SwitchPlayerMapWithPassword("Alice", 2, "guess"), ErrWrongPassword)
+	assert.NoError(t, g.SwitchPlayerMapWithPassword("Alice", 2, "secret"))
+	assert.ErrorIs(t, g.SwitchPlayerMapWithPassword("Bob", 2, "secret"), ErrMapFull)
+
+	// Room frees up when Alice leaves.
+	assert.NoError(t, g.SwitchPlayerMap("Alice", 1))
+	assert.NoError(t, g.SwitchPlayerMapWithPassword("Bob", 2, "secret"))
+}
+
+func TestRemoveMap(t *testing.T) {
+	g, _ := NewGame([]int{1, 2})
+	require.NoError(t, g.AddMap(3, MapOptions{Capacity: 1}))
+	for _, name := range []string{"Alice", "Bob", "Cyn"} {
+		g.ConnectPlayer(name)
+	}
+	g.SwitchPlayerMap("Alice", 1)
+	g.SwitchPlayerMap("Bob", 1)
+	g.SwitchPlayerMap("Cyn", 3)
+	cyn, _ := g.GetPlayer("Cyn")
+	<-cyn.GetChannel() // welcome
+
+	assert.EqualError(t, g.RemoveMap(9, 0), "map not found")
+	assert.EqualError(t, g.RemoveMap(1, 1), "invalid evacuation map")
+	assert.EqualError(t, g.RemoveMap(1, 9), "invalid evacuation map")
+
+	// Everyone in map 1 moves to map 3, even though it is full.
+	require.NoError(t, g.RemoveMap(1, 3))
+	assert.Equal(t, []string{"Alice", "Bob", "Cyn"}, g.maps[3].PlayerNames())
+	alice, _ := g.GetPlayer("Alice")
+	for {
+		msg := <-alice.GetChannel()
+		if msg.Text() == "Map 1 was closed" {
+			break
+		}
+	}
+	assert.Equal(t, 3, alice.m.id)
+	assert.EqualError(t, g.SwitchPlayerMap("Alice", 1), "map not found")
+	assert.NoError(t, alice.SendMessage("hi"), "the player talks in map 3 now")
+
+	// Without an evacuation map, players are left out of any map.
+	require.NoError(t, g.RemoveMap(3, 0))
+	assert.Nil(t, alice.m)
+	assert.EqualError(t, alice.SendMessage("hi"), "player is not connected")
+	assert.NoError(t, g.SwitchPlayerMap("Alice", 2))
+
+	assert.NoError(t, g.Shutdown(context.Background()))
+}
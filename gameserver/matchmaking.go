@@ -0,0 +1,441 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrMatchmakerClosed = errors.New("matchmaker is closed")
+	ErrAlreadyQueued    = errors.New("player is already queued")
+	ErrNotQueued        = errors.New("player is not queued")
+	// ErrNoMatch is returned by Ticket.Wait for a ticket closed without a match.
+	ErrNoMatch = errors.New("ticket was closed without a match")
+)
+
+// MatchPreferences is what a player asks of the players it is matched with.
+type MatchPreferences struct {
+	// Skill is the player's rating; a group only holds players of close skill.
+	Skill int
+	// Region, when set, only matches the player with players of the same region
+	// or without one.
+	Region string
+}
+
+// Match is the group a player was matched in, and the map it was sent to.
+type Match struct {
+	Map     int
+	Players []string // display names, sorted
+}
+
+// MatchmakerOptions configures a Matchmaker.
+type MatchmakerOptions struct {
+	// GroupSize is how many players a match holds. Defaults to 2.
+	GroupSize int
+	// Interval is how often the matcher looks for groups. Defaults to 1s.
+	Interval time.Duration
+
+	// SkillRange is the largest skill difference with the oldest player of a group.
+	SkillRange int
+	// Every WidenEvery a player waits, the skill range it accepts grows by WidenBy.
+	// Zero never widens it.
+	WidenEvery time.Duration
+	WidenBy    int
+	// RegionTimeout is how long a player waits before it is matched with players
+	// of any region. Zero always keeps the region.
+	RegionTimeout time.Duration
+
+	// MapOptions are the options of the maps created for matches, when no empty map is free.
+	MapOptions MapOptions
+}
+
+// withDefaults fills the zero fields of the options.
+func (o MatchmakerOptions) withDefaults() MatchmakerOptions {
+	if o.GroupSize <= 0 {
+		o.GroupSize = 2
+	}
+	if o.Interval <= 0 {
+		o.Interval = time.Second
+	}
+	return o
+}
+
+// Ticket is the place of a player in the matchmaking queue.
+type Ticket struct {
+	p     *Player
+	prefs MatchPreferences
+	since time.Time
+	c     chan Match
+}
+
+// Match returns a channel that receives the match of the player once it is
+// found. It is closed without a match if the ticket is canceled, if the player
+// disconnects, or if the matchmaker is closed.
+func (t *Ticket) Match() <-chan Match {
+	return t.c
+}
+
+// Wait waits for the match of the player. It returns ErrNoMatch if the ticket
+// is closed without one, or ctx.Err() if ctx ends first; the ticket stays queued then.
+func (t *Ticket) Wait(ctx context.Context) (Match, error) {
+	select {
+	case m, ok := <-t.c:
+		if !ok {
+			return Match{}, ErrNoMatch
+		}
+		return m, nil
+	case <-ctx.Done():
+		return Match{}, ctx.Err()
+	}
+}
+
+// wait returns how long the ticket has been queued at now.
+func (t *Ticket) wait(now time.Time) time.Duration {
+	return now.Sub(t.since)
+}
+
+// Matchmaker puts players in maps so map IDs need not be picked by hand.
+// Players enqueue with their preferences, and a matcher goroutine forms groups
+// of GroupSize players, oldest tickets first, and sends every group to an empty
+// map of the game, or to a new one. The longer a player waits, the more its
+// constraints are relaxed (see MatchmakerOptions).
+//
+// Players are moved like with SwitchPlayerMap, while the matchmaker is locked:
+// the OnSwitch hook of a plugin must not call the matchmaker. A group is only
+// matched whole: if one of its players cannot be moved, the others go back
+// where they were and the group waits for the next round.
+type Matchmaker struct {
+	g    *Game
+	opts MatchmakerOptions
+
+	mu     sync.Mutex
+	queue  []*Ticket          // oldest first
+	queued map[string]*Ticket // lowercase name → ticket
+	closed bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewMatchmaker starts a matchmaker for g. It uses the clock of the game.
+func NewMatchmaker(g *Game, opts MatchmakerOptions) *Matchmaker {
+	mm := &Matchmaker{
+		g:      g,
+		opts:   opts.withDefaults(),
+		queued: make(map[string]*Ticket),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go mm.loop()
+	return mm
+}
+
+// Enqueue puts a connected player in the queue.
+func (mm *Matchmaker) Enqueue(name string, prefs MatchPreferences) (*Ticket, error) {
+	p, err := mm.g.GetPlayer(name)
+	if err != nil {
+		return nil, err
+	}
+
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	if mm.closed {
+		return nil, ErrMatchmakerClosed
+	}
+	key := strings.ToLower(name)
+	if _, ok := mm.queued[key]; ok {
+		return nil, ErrAlreadyQueued
+	}
+	t := &Ticket{p: p, prefs: prefs, since: mm.g.opts.Clock.Now(), c: make(chan Match, 1)}
+	mm.queue = append(mm.queue, t)
+	mm.queued[key] = t
+	return t, nil
+}
+
+// Cancel takes a player out of the queue.
+func (mm *Matchmaker) Cancel(name string) error {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	t, ok := mm.queued[strings.ToLower(name)]
+	if !ok {
+		return ErrNotQueued
+	}
+	mm.drop(t)
+	close(t.c)
+	return nil
+}
+
+// Queued returns how many players are waiting for a match.
+func (mm *Matchmaker) Queued() int {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	return len(mm.queue)
+}
+
+// Close stops the matcher and closes the channels of the tickets still queued.
+func (mm *Matchmaker) Close() {
+	mm.mu.Lock()
+	if mm.closed {
+		mm.mu.Unlock()
+		<-mm.done
+		return
+	}
+	mm.closed = true
+	for _, t := range mm.queue {
+		close(t.c)
+	}
+	mm.queue = nil
+	mm.queued = make(map[string]*Ticket)
+	close(mm.stop)
+	mm.mu.Unlock()
+	<-mm.done
+}
+
+// drop removes t from the queue. The caller must hold mm.mu.
+func (mm *Matchmaker) drop(t *Ticket) {
+	delete(mm.queued, strings.ToLower(t.p.name))
+	for i, q := range mm.queue {
+		if q == t {
+			mm.queue = append(mm.queue[:i], mm.queue[i+1:]...)
+			return
+		}
+	}
+}
+
+// loop runs a matching round every Interval until the matchmaker is closed.
+func (mm *Matchmaker) loop() {
+	defer close(mm.done)
+	ticker := mm.g.opts.Clock.NewTicker(mm.opts.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			mm.round()
+		case <-mm.stop:
+			return
+		}
+	}
+}
+
+// round forms as many groups as it can and sends each one to a map.
+func (mm *Matchmaker) round() {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+	now := mm.g.opts.Clock.Now()
+
+	// 1) Forget players who left the game since they enqueued.
+	for _, t := range append([]*Ticket(nil), mm.queue...) {
+		if !mm.g.connected(t.p) {
+			mm.drop(t)
+			close(t.c)
+		}
+	}
+
+	// 2) Form groups around the oldest tickets, and send them to a map.
+	// A group that could not be placed whole stays queued for the next round,
+	// but for the players who left the game meanwhile.
+	for _, group := range mm.groups(now) {
+		id, err := mm.g.placeGroup(group, mm.opts.MapOptions)
+		if err != nil {
+			for _, t := range group {
+				if !mm.g.connected(t.p) {
+					mm.drop(t)
+					close(t.c)
+				}
+			}
+			continue
+		}
+		names := make([]string, 0, len(group))
+		for _, t := range group {
+			names = append(names, t.p.name)
+		}
+		sort.Strings(names)
+		for _, t := range group {
+			mm.drop(t)
+			t.c <- Match{Map: id, Players: names}
+		}
+	}
+}
+
+// groups splits the queue into groups of GroupSize tickets compatible with each
+// other. Each group is formed around the oldest ticket left, with the candidates
+// of closest skill. The caller must hold mm.mu.
+func (mm *Matchmaker) groups(now time.Time) [][]*Ticket {
+	var groups [][]*Ticket
+	taken := make(map[*Ticket]bool)
+	for i, anchor := range mm.queue {
+		if taken[anchor] {
+			continue
+		}
+		var candidates []*Ticket
+		for _, t := range mm.queue[i+1:] {
+			if !taken[t] && mm.compatible(anchor, t, now) {
+				candidates = append(candidates, t)
+			}
+		}
+		// The sort is stable, so among equal skills the oldest go first.
+		sort.SliceStable(candidates, func(a, b int) bool {
+			return skillGap(anchor, candidates[a]) < skillGap(anchor, candidates[b])
+		})
+		// Each candidate must also suit everyone picked before it: the skills stay
+		// within range of each other, and the regions match.
+		group := []*Ticket{anchor}
+		for _, c := range candidates {
+			if len(group) == mm.opts.GroupSize {
+				break
+			}
+			if !slices.ContainsFunc(group, func(t *Ticket) bool { return !mm.compatible(t, c, now) }) {
+				group = append(group, c)
+			}
+		}
+		if len(group) < mm.opts.GroupSize {
+			continue
+		}
+		for _, t := range group {
+			taken[t] = true
+		}
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// compatible reports whether a and b can play together at now: their skills
+// are within the range of the one who waited longest, and their regions match
+// unless one of them waited past RegionTimeout.
+func (mm *Matchmaker) compatible(a, b *Ticket, now time.Time) bool {
+	wait := max(a.wait(now), b.wait(now))
+	if skillGap(a, b) > mm.skillRange(wait) {
+		return false
+	}
+	if a.prefs.Region == "" || b.prefs.Region == "" || a.prefs.Region == b.prefs.Region {
+		return true
+	}
+	return mm.opts.RegionTimeout > 0 && wait >= mm.opts.RegionTimeout
+}
+
+// skillRange returns the skill range accepted after waiting wait.
+func (mm *Matchmaker) skillRange(wait time.Duration) int {
+	if mm.opts.WidenEvery <= 0 {
+		return mm.opts.SkillRange
+	}
+	return mm.opts.SkillRange + int(wait/mm.opts.WidenEvery)*mm.opts.WidenBy
+}
+
+func skillGap(a, b *Ticket) int {
+	d := a.prefs.Skill - b.prefs.Skill
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// connected reports whether p is still in the game.
+func (g *Game) connected(p *Player) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.players[strings.ToLower(p.name)] == p
+}
+
+// placeGroup sends the players of a match to the empty map of lowest id that
+// fits them and has no password, or to a new map created with opts, and returns
+// its id. Each player is moved with SwitchPlayerMap, so the checks and plugin
+// hooks of a move apply. If any player is not in the map at the end (it left
+// the game, was refused, or was sent elsewhere by a plugin), the players moved
+// so far are sent back and errGroupNotPlaced is returned.
+func (g *Game) placeGroup(group []*Ticket, opts MapOptions) (int, error) {
+	id, err := g.matchMap(len(group), opts)
+	if err != nil {
+		return 0, err
+	}
+	// 1) Move the players one by one, remembering where they were.
+	from := make([]int, 0, len(group))
+	placed := true
+	for _, t := range group {
+		g.mu.Lock()
+		from = append(from, t.p.zone)
+		g.mu.Unlock()
+		if g.SwitchPlayerMap(t.p.name, id) != nil {
+			placed = false
+			break
+		}
+	}
+
+	// 2) Check them all at the end: a later move may have let an earlier
+	// player leave, or a plugin may have sent a player elsewhere.
+	for _, t := range group {
+		placed = placed && g.inMap(t.p, id)
+	}
+	if !placed {
+		for i := range from {
+			g.unplace(group[i].p, id, from[i])
+		}
+		return 0, errGroupNotPlaced
+	}
+	return id, nil
+}
+
+// errGroupNotPlaced is returned by placeGroup when a group could not be moved whole.
+var errGroupNotPlaced = errors.New("group could not be placed")
+
+// inMap reports whether p is still in the game, in the map id.
+func (g *Game) inMap(p *Player, id int) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.players[strings.ToLower(p.name)] == p && p.zone == id
+}
+
+// unplace sends p, moved to the map id for a match that fell through, back to
+// the map from, whatever its capacity and password, or out of any map if from
+// is -1 or was removed since. A player who left the map id meanwhile is left alone.
+func (g *Game) unplace(p *Player, id, from int) {
+	defer g.flushStore()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.players[strings.ToLower(p.name)] != p || p.zone != id {
+		return
+	}
+	if back, ok := g.maps[from]; ok {
+		g.switchMap(p, back)
+		return
+	}
+	m := p.m
+	m.mu.Lock()
+	m.leave(p)
+	m.notify(leaveMessage(p, m.id))
+	p.zone = -1
+	p.m = nil
+	g.persistPlayer(p)
+	m.mu.Unlock()
+}
+
+// matchMap returns the empty map of lowest id that fits n players and has no
+// password, or creates one with opts after the highest id.
+func (g *Game) matchMap(n int, opts MapOptions) (int, error) {
+	defer g.flushStore()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return 0, ErrGameShutDown
+	}
+
+	last := 0
+	for _, id := range sortedMapIds(g.maps) {
+		m := g.maps[id]
+		last = id
+		if m.password == "" && len(m.players) == 0 && (m.capacity == 0 || m.capacity >= n) {
+			return id, nil
+		}
+	}
+	m, err := newMap(last+1, opts)
+	if err != nil {
+		return 0, err
+	}
+	g.attachMap(m)
+	g.queue(Record{Op: OpMap, Map: m.id, MapOptions: &opts})
+	return m.id, nil
+}
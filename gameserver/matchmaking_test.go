@@ -0,0 +1,310 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// matchTest runs a matchmaker on a manual clock.
+type matchTest struct {
+	t     *testing.T
+	g     *Game
+	mm    *Matchmaker
+	clock *manualClock
+}
+
+func newMatchTest(t *testing.T, mapIds []int, opts MatchmakerOptions) *matchTest {
+	g, clock := newTestGame(t, mapIds, Options{})
+	mm := NewMatchmaker(g, opts)
+	t.Cleanup(mm.Close)
+	clock.waitTickers(t, 1)
+	return &matchTest{t: t, g: g, mm: mm, clock: clock}
+}
+
+func (mt *matchTest) enqueue(name string, prefs MatchPreferences) *Ticket {
+	require.NoError(mt.t, mt.g.ConnectPlayer(name))
+	ticket, err := mt.mm.Enqueue(name, prefs)
+	require.NoError(mt.t, err)
+	return ticket
+}
+
+// advance moves the clock forward and waits until the rounds it started are over.
+func (mt *matchTest) advance(d time.Duration) {
+	mt.clock.advance(d)
+	// The matcher only takes another tick once it is done with the previous round.
+	// This extra round at the same time finds nothing new, but may try again
+	// a group that could not be placed: it can still run after advance returns.
+	mt.clock.tickers[0].c <- mt.clock.Now()
+}
+
+func matched(ticket *Ticket) (Match, bool) {
+	select {
+	case m, ok := <-ticket.Match():
+		return m, ok
+	default:
+		return Match{}, false
+	}
+}
+
+func TestMatchBySkill(t *testing.T) {
+	mt := newMatchTest(t, []int{1, 2}, MatchmakerOptions{SkillRange: 50})
+	alice := mt.enqueue("Alice", MatchPreferences{Skill: 1000})
+	bob := mt.enqueue("Bob", MatchPreferences{Skill: 1500})
+	carol := mt.enqueue("Carol", MatchPreferences{Skill: 1010})
+	dave := mt.enqueue("Dave", MatchPreferences{Skill: 1490})
+	assert.Equal(t, 4, mt.mm.Queued())
+
+	mt.advance(time.Second)
+	want := Match{Map: 1, Players: []string{"Alice", "Carol"}}
+	for _, ticket := range []*Ticket{alice, carol} {
+		m, ok := matched(ticket)
+		assert.True(t, ok)
+		assert.Equal(t, want, m)
+	}
+	want = Match{Map: 2, Players: []string{"Bob", "Dave"}}
+	for _, ticket := range []*Ticket{bob, dave} {
+		m, ok := matched(ticket)
+		assert.True(t, ok)
+		assert.Equal(t, want, m)
+	}
+	assert.Equal(t, 0, mt.mm.Queued())
+	assert.Equal(t, []string{"Alice", "Carol"}, mt.g.maps[1].PlayerNames())
+	assert.Equal(t, []string{"Bob", "Dave"}, mt.g.maps[2].PlayerNames())
+}
+
+func TestMatchPicksClosestSkill(t *testing.T) {
+	mt := newMatchTest(t, []int{1}, MatchmakerOptions{GroupSize: 3, SkillRange: 100})
+	a := mt.enqueue("A", MatchPreferences{Skill: 1000})
+	b := mt.enqueue("B", MatchPreferences{Skill: 1090})
+	c := mt.enqueue("C", MatchPreferences{Skill: 1005})
+	d := mt.enqueue("D", MatchPreferences{Skill: 1020})
+
+	mt.advance(time.Second)
+	m, ok := matched(a)
+	require.True(t, ok)
+	assert.Equal(t, []string{"A", "C", "D"}, m.Players)
+	_, ok = matched(b)
+	assert.False(t, ok)
+	_, ok = matched(c)
+	assert.True(t, ok)
+	_, ok = matched(d)
+	assert.True(t, ok)
+	assert.Equal(t, 1, mt.mm.Queued())
+}
+
+func TestMatchWidensSkillRange(t *testing.T) {
+	mt := newMatchTest(t, []int{1}, MatchmakerOptions{SkillRange: 50, WidenEvery: 10 * time.Second, WidenBy: 50})
+	alice := mt.enqueue("Alice", MatchPreferences{Skill: 1000})
+	bob := mt.enqueue("Bob", MatchPreferences{Skill: 1200})
+
+	// The range grows to 200 after 30s of waiting.
+	mt.advance(29 * time.Second)
+	_, ok := matched(alice)
+	assert.False(t, ok)
+
+	mt.advance(time.Second)
+	m, ok := matched(alice)
+	require.True(t, ok)
+	assert.Equal(t, Match{Map: 1, Players: []string{"Alice", "Bob"}}, m)
+	_, ok = matched(bob)
+	assert.True(t, ok)
+}
+
+func TestMatchRelaxesRegion(t *testing.T) {
+	mt := newMatchTest(t, []int{1}, MatchmakerOptions{RegionTimeout: 30 * time.Second})
+	alice := mt.enqueue("Alice", MatchPreferences{Region: "eu"})
+	mt.advance(20 * time.Second)
+	bob := mt.enqueue("Bob", MatchPreferences{Region: "us"})
+
+	// Alice waited 20s: still too early to play with another region.
+	mt.advance(time.Second)
+	_, ok := matched(alice)
+	assert.False(t, ok)
+
+	// Once Alice waited 30s, Bob is fine even though he just arrived.
+	mt.advance(9 * time.Second)
+	_, ok = matched(alice)
+	assert.True(t, ok)
+	_, ok = matched(bob)
+	assert.True(t, ok)
+
+	// A player without a region plays with anyone.
+	carol := mt.enqueue("Carol", MatchPreferences{Region: "eu"})
+	dave := mt.enqueue("Dave", MatchPreferences{})
+	mt.advance(time.Second)
+	m, ok := matched(carol)
+	assert.True(t, ok)
+	assert.Equal(t, Match{Map: 2, Players: []string{"Carol", "Dave"}}, m)
+	_, ok = matched(dave)
+	assert.True(t, ok)
+}
+
+func TestMatchCreatesMaps(t *testing.T) {
+	mt := newMatchTest(t, []int{1, 2}, MatchmakerOptions{MapOptions: MapOptions{Capacity: 2}})
+	// Map 1 is busy and map 2 has a password: neither takes the match.
+	require.NoError(t, mt.g.ConnectPlayer("Lobby"))
+	require.NoError(t, mt.g.SwitchPlayerMap("Lobby", 1))
+	mt.g.maps[2].password = "secret"
+
+	alice := mt.enqueue("Alice", MatchPreferences{})
+	mt.enqueue("Bob", MatchPreferences{})
+	mt.advance(time.Second)
+	m, ok := matched(alice)
+	require.True(t, ok)
+	assert.Equal(t, 3, m.Map)
+	created, err := mt.g.GetMap(3)
+	require.NoError(t, err)
+	assert.Equal(t, 2, created.capacity)
+	assert.Equal(t, []string{"Alice", "Bob"}, created.PlayerNames())
+}
+
+func TestMatchCancel(t *testing.T) {
+	mt := newMatchTest(t, []int{1}, MatchmakerOptions{})
+	alice := mt.enqueue("Alice", MatchPreferences{})
+
+	_, err := mt.mm.Enqueue("Alice", MatchPreferences{})
+	assert.EqualError(t, err, "player is already queued")
+	_, err = mt.mm.Enqueue("Nobody", MatchPreferences{})
+	assert.EqualError(t, err, "player not found")
+
+	require.NoError(t, mt.mm.Cancel("alice"))
+	_, open := <-alice.Match()
+	assert.False(t, open)
+	assert.EqualError(t, mt.mm.Cancel("Alice"), "player is not queued")
+
+	// Bob's disconnection drops his ticket too, so Carol waits alone.
+	bob := mt.enqueue("Bob", MatchPreferences{})
+	carol := mt.enqueue("Carol", MatchPreferences{})
+	require.NoError(t, mt.g.DisconnectPlayer("Bob"))
+	mt.advance(time.Second)
+	_, open = <-bob.Match()
+	assert.False(t, open)
+	_, ok := matched(carol)
+	assert.False(t, ok)
+	assert.Equal(t, 1, mt.mm.Queued())
+
+	mt.mm.Close()
+	_, open = <-carol.Match()
+	assert.False(t, open)
+	_, err = mt.mm.Enqueue("Carol", MatchPreferences{})
+	assert.EqualError(t, err, "matchmaker is closed")
+}
+
+func TestMatchGroupFitsTogether(t *testing.T) {
+	// The anchor fits anyone, but "eu" and "us" do not fit each other.
+	mt := newMatchTest(t, []int{1, 2}, MatchmakerOptions{GroupSize: 3, SkillRange: 100})
+	anchor := mt.enqueue("Anchor", MatchPreferences{})
+	mt.enqueue("Eu", MatchPreferences{Region: "eu"})
+	us := mt.enqueue("Us", MatchPreferences{Region: "us"})
+	mt.advance(time.Second)
+	_, ok := matched(anchor)
+	assert.False(t, ok)
+
+	mt.enqueue("Eu2", MatchPreferences{Region: "eu"})
+	mt.advance(time.Second)
+	m, ok := matched(anchor)
+	require.True(t, ok)
+	assert.Equal(t, []string{"Anchor", "Eu", "Eu2"}, m.Players)
+	_, ok = matched(us)
+	assert.False(t, ok)
+
+	// B and C are both close to A, but too far apart to play together.
+	a := mt.enqueue("A", MatchPreferences{Skill: 1000})
+	mt.enqueue("B", MatchPreferences{Skill: 900})
+	mt.enqueue("C", MatchPreferences{Skill: 1100})
+	mt.advance(time.Second)
+	_, ok = matched(a)
+	assert.False(t, ok)
+
+	mt.enqueue("D", MatchPreferences{Skill: 1050})
+	mt.advance(time.Second)
+	m, ok = matched(a)
+	require.True(t, ok)
+	assert.Equal(t, []string{"A", "C", "D"}, m.Players)
+}
+
+// switchPlugin runs onSwitch for every move.
+type switchPlugin struct {
+	NopPlugin
+	onSwitch func(e *SwitchEvent) error
+}
+
+func (pl switchPlugin) OnSwitch(e *SwitchEvent) error { return pl.onSwitch(e) }
+
+func TestMatchPlacesThroughSwitch(t *testing.T) {
+	mt := newMatchTest(t, []int{1, 2}, MatchmakerOptions{})
+	mt.g.AddPlugin(switchPlugin{onSwitch: func(e *SwitchEvent) error {
+		switch e.Player {
+		case "Bob":
+			return errVetoed
+		case "Carol":
+			// Dave leaves while the match is placed.
+			mt.g.DisconnectPlayer("Dave")
+		}
+		return nil
+	}})
+
+	// Bob is refused: Alice is sent back, and both wait for another match.
+	alice := mt.enqueue("Alice", MatchPreferences{})
+	bob := mt.enqueue("Bob", MatchPreferences{})
+	mt.advance(time.Second)
+	_, ok := matched(alice)
+	assert.False(t, ok)
+	_, ok = matched(bob)
+	assert.False(t, ok)
+	assert.Equal(t, 2, mt.mm.Queued())
+	// The extra round of advance may still be trying them: check the map once they are out of the queue.
+	require.NoError(t, mt.mm.Cancel("Alice"))
+	require.NoError(t, mt.mm.Cancel("Bob"))
+	assert.Empty(t, mt.g.maps[1].PlayerNames())
+
+	// Dave left before he was moved: his ticket is closed without a match,
+	// and Carol waits for another one.
+	carol := mt.enqueue("Carol", MatchPreferences{})
+	dave := mt.enqueue("Dave", MatchPreferences{})
+	mt.advance(time.Second)
+	_, ok = matched(carol)
+	assert.False(t, ok)
+	_, open := <-dave.Match()
+	assert.False(t, open)
+	assert.Empty(t, mt.g.maps[1].PlayerNames())
+	assert.Equal(t, 1, mt.mm.Queued())
+}
+
+func TestMatchPartialPlacement(t *testing.T) {
+	mt := newMatchTest(t, nil, MatchmakerOptions{MapOptions: MapOptions{Capacity: 2}})
+	require.NoError(t, mt.g.AddMap(5, MapOptions{}))
+	require.NoError(t, mt.g.ConnectPlayer("Eve"))
+	filled := false
+	mt.g.AddPlugin(switchPlugin{onSwitch: func(e *SwitchEvent) error {
+		// Eve takes the last seat of the new map just before Bob gets there.
+		if e.Player == "Bob" && !filled {
+			filled = true
+			mt.g.SwitchPlayerMap("Eve", e.To)
+		}
+		return nil
+	}})
+
+	// Alice is moved to map 6, then Bob finds it full: Alice goes back to
+	// map 5 rather than get a match alone, and the group waits. The extra
+	// round of advance places the whole group in a new map; the second
+	// advance waits for it.
+	alice := mt.enqueue("Alice", MatchPreferences{})
+	require.NoError(t, mt.g.SwitchPlayerMap("Alice", 5))
+	bob := mt.enqueue("Bob", MatchPreferences{})
+	mt.advance(time.Second)
+	mt.advance(0)
+	assert.True(t, filled)
+	assert.Equal(t, []string{"Eve"}, mt.g.maps[6].PlayerNames())
+	want := Match{Map: 7, Players: []string{"Alice", "Bob"}}
+	m, ok := matched(alice)
+	require.True(t, ok)
+	assert.Equal(t, want, m)
+	m, ok = matched(bob)
+	require.True(t, ok)
+	assert.Equal(t, want, m)
+	assert.Empty(t, mt.g.maps[5].PlayerNames())
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// MessageKind tells clients how to present a Message.
+type MessageKind string
+
+const (
+	KindChat     MessageKind = "chat"     // a player talking in a map
+	KindSystem   MessageKind = "system"   // a notice from the server
+	KindJoin     MessageKind = "join"     // a player entered a map
+	KindLeave    MessageKind = "leave"    // a player left a map
+	KindEmote    MessageKind = "emote"    // a player action, like "/me waves"
+	KindWhisper  MessageKind = "whisper"  // a direct message to a single player
+	KindSnapshot MessageKind = "snapshot" // world state from the tick loop, in Message.Snapshot
+)
+
+// Message is the unit that flows through Map.ch and Player.ch.
+type Message struct {
+	ID     uint64      // unique for the lifetime of the process, increasing
+	Sender string      // name of the sending player, "" for server messages
+	Map    int         // ID of the map the message was sent in, 0 if none
+	Kind   MessageKind // how the message should be shown
+	Body   string      // the raw text, without the sender's name
+	Time   time.Time   // when the message was created
+
+	Snapshot *Snapshot // set for KindSnapshot only
+}
+
+// lastMessageID is the ID of the last message created by newMessage.
+var lastMessageID atomic.Uint64
+
+// newMessage creates a message with the next ID and the current time of the game's clock.
+func (g *Game) newMessage(sender string, mapId int, kind MessageKind, body string) Message {
+	return Message{
+		ID:     lastMessageID.Add(1),
+		Sender: sender,
+		Map:    mapId,
+		Kind:   kind,
+		Body:   body,
+		Time:   g.opts.Clock.Now(),
+	}
+}
+
+// bumpMessageID makes sure the next message IDs are greater than id.
+func bumpMessageID(id uint64) {
+	for {
+		last := lastMessageID.Load()
+		if last >= id || lastMessageID.CompareAndSwap(last, id) {
+			return
+		}
+	}
+}
+
+// Text renders the message as the plain text clients used to receive,
+// e.g. "Mamad says: hello" for a chat message.
+func (msg Message) Text() string {
+	name := displayName(msg.Sender)
+	switch msg.Kind {
+	case KindChat:
+		return name + " says: " + msg.Body
+	case KindEmote:
+		return "* " + name + " " + msg.Body
+	case KindWhisper:
+		return name + " whispers: " + msg.Body
+	default:
+		return msg.Body
+	}
+}
+
+// senderKey is the lowercase key of the sender, as used in Game.players.
+func (msg Message) senderKey() string {
+	return strings.ToLower(msg.Sender)
+}
+
+// displayName builds a display-friendly name: first letter uppercase, rest lowercase.
+func displayName(name string) string {
+	lower := strings.ToLower(name)
+	if len(lower) == 0 {
+		return ""
+	}
+	return strings.ToUpper(lower[:1]) + lower[1:]
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageText(t *testing.T) {
+	g, _ := NewGame(nil)
+	assert.Equal(t, "Mamad says: hello", g.newMessage("mAMAD", 1, KindChat, "hello").Text())
+	assert.Equal(t, "* Mamad waves", g.newMessage("Mamad", 1, KindEmote, "waves").Text())
+	assert.Equal(t, "server restarts soon", g.newMessage("", 0, KindSystem, "server restarts soon").Text())
+}
+
+func TestMessageFields(t *testing.T) {
+	g, _ := NewGame([]int{4})
+	g.ConnectPlayer("Alice")
+	g.SwitchPlayerMap("Alice", 4)
+	g.ConnectPlayer("Bob")
+	g.SwitchPlayerMap("Bob", 4)
+	alice, _ := g.GetPlayer("Alice")
+	bob, _ := g.GetPlayer("Bob")
+	assert.Equal(t, KindSystem, (<-alice.GetChannel()).Kind) // welcome
+	assert.Equal(t, KindJoin, (<-alice.GetChannel()).Kind)   // Bob joined
+	assert.Equal(t, KindSystem, (<-bob.GetChannel()).Kind)   // welcome
+
+	// A NUL byte used to break the old "<sender>\x00<text>" packets.
+	before := time.Now()
+	assert.Nil(t, alice.SendMessage("a\x00b"))
+	assert.Nil(t, alice.SendMessage("second"))
+
+	first := <-bob.GetChannel()
+	assert.Equal(t, "Alice", first.Sender)
+	assert.Equal(t, 4, first.Map)
+	assert.Equal(t, KindChat, first.Kind)
+	assert.Equal(t, "a\x00b", first.Body)
+	assert.False(t, first.Time.Before(before))
+
+	second := <-bob.GetChannel()
+	assert.Greater(t, second.ID, first.ID)
+	assert.Len(t, alice.GetChannel(), 0, "the sender does not get an echo")
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"strings"
+	"time"
+)
+
+// Role is what a player is allowed to do in the game.
+type Role int
+
+const (
+	RolePlayer    Role = iota // a regular player (the default)
+	RoleModerator             // keeps the chat clean: may kick, ban and mute
+	RoleAdmin                 // runs the server: may also set roles; cannot be kicked or banned
+)
+
+func (r Role) String() string {
+	switch r {
+	case RolePlayer:
+		return "player"
+	case RoleModerator:
+		return "moderator"
+	case RoleAdmin:
+		return "admin"
+	default:
+		return "unknown"
+	}
+}
+
+// Role returns the role of the player.
+func (p *Player) Role() Role {
+	p.g.mu.Lock()
+	defer p.g.mu.Unlock()
+	return p.role
+}
+
+// authorize checks that the player by has at least the role min. An empty by
+// is the server itself, which may do anything. The caller must hold g.mu.
+func (g *Game) authorize(by string, min Role) error {
+	if by == "" {
+		return nil
+	}
+	p, ok := g.players[strings.ToLower(by)]
+	if !ok || p.role < min {
+		return ErrNotAuthorized
+	}
+	return nil
+}
+
+// SetRole changes the role of a connected player. Only an admin, or the
+// server with an empty by, may do it; by is the name of the player acting,
+// as for every moderation call.
+func (g *Game) SetRole(by, name string, role Role) error {
+	if role < RolePlayer || role > RoleAdmin {
+		return ErrInvalidRole
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.authorize(by, RoleAdmin); err != nil {
+		return err
+	}
+	p, ok := g.players[strings.ToLower(name)]
+	if !ok {
+		return ErrPlayerNotFound
+	}
+	p.role = role
+	return nil
+}
+
+// Kick disconnects a player, who gets a last system message with the reason.
+// The player can connect again right away; use Ban to keep them out.
+// by must be a moderator or an admin.
+func (g *Game) Kick(by, name, reason string) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.authorize(by, RoleModerator); err != nil {
+		return err
+	}
+	return g.kick(strings.ToLower(name), "You were kicked", reason)
+}
+
+// kick removes the player with the given key after telling them why.
+// The caller must hold g.mu.
+func (g *Game) kick(key, notice, reason string) error {
+	p, ok := g.players[key]
+	if !ok {
+		return ErrPlayerNotFound
+	}
+	if p.role == RoleAdmin {
+		return ErrCannotKickAdmin
+	}
+	if reason != "" {
+		notice += ": " + reason
+	}
+	p.deliver(g.newMessage("", 0, KindSystem, notice), false)
+	g.removePlayer(p)
+	return nil
+}
+
+// Ban keeps a player from connecting for d, or until Unban is called if d <= 0.
+// A connected player is kicked. Names are banned whether or not they are in use.
+// by must be a moderator or an admin.
+func (g *Game) Ban(by, name string, d time.Duration) error {
+	key := strings.ToLower(name)
+	defer g.flushStore()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.authorize(by, RoleModerator); err != nil {
+		return err
+	}
+	if p, ok := g.players[key]; ok {
+		if p.role == RoleAdmin {
+			return ErrCannotBanAdmin
+		}
+		g.kick(key, "You were banned", "")
+	}
+
+	var until time.Time // zero means forever
+	if d > 0 {
+		until = g.opts.Clock.Now().Add(d)
+	}
+	g.bans[key] = until
+	g.queue(Record{Op: OpBan, Player: key, Until: until})
+	return nil
+}
+
+// Unban lifts the ban on a name. by must be a moderator or an admin.
+func (g *Game) Unban(by, name string) error {
+	key := strings.ToLower(name)
+	defer g.flushStore()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.authorize(by, RoleModerator); err != nil {
+		return err
+	}
+	if !g.banned(key) {
+		return ErrNotBanned
+	}
+	delete(g.bans, key)
+	g.queue(Record{Op: OpUnban, Player: key})
+	return nil
+}
+
+// banned reports whether the name with the given key is banned right now,
+// and forgets the ban once it has expired. The caller must hold g.mu.
+func (g *Game) banned(key string) bool {
+	until, ok := g.bans[key]
+	if !ok {
+		return false
+	}
+	if !until.IsZero() && !g.opts.Clock.Now().Before(until) {
+		delete(g.bans, key)
+		return false
+	}
+	return true
+}
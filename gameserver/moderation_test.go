@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoles(t *testing.T) {
+	g, _ := NewGame([]int{1})
+	g.ConnectPlayer("Alice")
+	alice, _ := g.GetPlayer("Alice")
+
+	assert.Equal(t, RolePlayer, alice.Role())
+	assert.NoError(t, g.SetRole("", "alice", RoleModerator))
+	assert.Equal(t, RoleModerator, alice.Role())
+	assert.Equal(t, "moderator", alice.Role().String())
+
+	assert.EqualError(t, g.SetRole("", "Alice", Role(7)), "invalid role")
+	assert.EqualError(t, g.SetRole("", "nobody", RoleAdmin), "player not found")
+}
+
+func TestModerationNeedsRole(t *testing.T) {
+	g, _ := NewGame([]int{1})
+	for _, name := range []string{"Alice", "Mod", "Root", "Troll"} {
+		g.ConnectPlayer(name)
+	}
+	g.SetRole("", "Mod", RoleModerator)
+	g.SetRole("", "Root", RoleAdmin)
+
+	// Regular players cannot moderate, whoever they aim at.
+	assert.ErrorIs(t, g.Kick("Alice", "Troll", ""), ErrNotAuthorized)
+	assert.ErrorIs(t, g.Ban("Alice", "Troll", 0), ErrNotAuthorized)
+	assert.ErrorIs(t, g.Mute("Alice", "Troll", 0), ErrNotAuthorized)
+	assert.ErrorIs(t, g.Kick("nobody", "Troll", ""), ErrNotAuthorized)
+
+	// Moderators can, but only admins set roles.
+	assert.NoError(t, g.Mute("Mod", "Troll", 0))
+	assert.NoError(t, g.Unmute("mod", "Troll"))
+	assert.ErrorIs(t, g.SetRole("Mod", "Alice", RoleModerator), ErrNotAuthorized)
+	assert.NoError(t, g.SetRole("Root", "Alice", RoleModerator))
+	assert.NoError(t, g.Ban("Alice", "Troll", time.Hour))
+	assert.NoError(t, g.Unban("Root", "Troll"))
+}
+
+func TestKick(t *testing.T) {
+	g, _ := NewGame([]int{1})
+	g.ConnectPlayer("Alice")
+	g.ConnectPlayer("Troll")
+	g.SwitchPlayerMap("Alice", 1)
+	g.SwitchPlayerMap("Troll", 1)
+	alice, _ := g.GetPlayer("Alice")
+	troll, _ := g.GetPlayer("Troll")
+	<-alice.GetChannel() // welcome
+	<-troll.GetChannel() // welcome
+
+	assert.NoError(t, g.Kick("", "troll", "be nice"))
+	msg := <-troll.GetChannel()
+	assert.Equal(t, KindSystem, msg.Kind)
+	assert.Equal(t, "You were kicked: be nice", msg.Text())
+	_, open := <-troll.GetChannel()
+	assert.False(t, open, "the kicked player is disconnected")
+	for msg := range alice.GetChannel() {
+		if msg.Kind == KindLeave {
+			assert.Equal(t, "Troll left", msg.Text())
+			break
+		}
+	}
+
+	// A kick is not a ban.
+	assert.NoError(t, g.ConnectPlayer("Troll"))
+	assert.EqualError(t, g.Kick("", "nobody", ""), "player not found")
+
+	g.SetRole("", "Alice", RoleAdmin)
+	assert.EqualError(t, g.Kick("", "Alice", ""), "cannot kick an admin")
+	assert.EqualError(t, g.Ban("", "Alice", 0), "cannot ban an admin")
+}
+
+func TestBan(t *testing.T) {
+	g, clock := newTestGame(t, []int{1}, Options{})
+	g.ConnectPlayer("Troll")
+	troll, _ := g.GetPlayer("Troll")
+
+	assert.NoError(t, g.Ban("", "TROLL", time.Hour))
+	assert.Equal(t, "You were banned", (<-troll.GetChannel()).Text())
+	assert.EqualError(t, g.ConnectPlayer("troll"), "player is banned")
+
+	// The ban ends by itself.
+	clock.advance(time.Hour)
+	assert.NoError(t, g.ConnectPlayer("Troll"))
+	assert.EqualError(t, g.Unban("", "Troll"), "player is not banned")
+
+	// Names can be banned before they are used, and Unban lifts a permanent ban.
+	assert.NoError(t, g.Ban("", "Griefer", 0))
+	clock.advance(365 * 24 * time.Hour)
+	assert.EqualError(t, g.ConnectPlayer("Griefer"), "player is banned")
+	assert.NoError(t, g.Unban("", "griefer"))
+	assert.NoError(t, g.ConnectPlayer("Griefer"))
+}
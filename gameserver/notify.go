@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// notify queues a server-generated message in the map's channel so that
+// FanOutMessages delivers it like any chat message. Since callers hold map
+// locks, it never blocks whatever the backpressure policy: the notice is
+// dropped if the channel is full.
+func (m *Map) notify(msg Message) {
+	m.enqueue(context.Background(), msg, false)
+}
+
+// welcome sends p a system message listing the other players in m.
+// The caller must hold m.mu, and p must already be in m.players.
+func (m *Map) welcome(p *Player) {
+	others := make([]string, 0, len(m.players))
+	for _, other := range m.players {
+		if other != p {
+			others = append(others, displayName(other.name))
+		}
+	}
+	sort.Strings(others)
+
+	text := fmt.Sprintf("Welcome to map %d! You are the first one here.", m.id)
+	if len(others) > 0 {
+		text = fmt.Sprintf("Welcome to map %d! Players here: %s", m.id, strings.Join(others, ", "))
+	}
+
+	p.deliver(m.g.newMessage("", m.id, KindSystem, text), false)
+}
+
+// joinMessage and leaveMessage are the notices broadcast when p moves. The
+// sender is p itself, so FanOutMessages does not echo them back to p.
+func joinMessage(p *Player, mapId int) Message {
+	return p.g.newMessage(p.name, mapId, KindJoin, displayName(p.name)+" joined")
+}
+
+func leaveMessage(p *Player, mapId int) Message {
+	return p.g.newMessage(p.name, mapId, KindLeave, displayName(p.name)+" left")
+}
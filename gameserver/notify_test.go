@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJoinLeaveNotifications(t *testing.T) {
+	g, _ := NewGame([]int{1, 2})
+	for _, name := range []string{"Alice", "Bob", "Carol"} {
+		g.ConnectPlayer(name)
+	}
+	alice, _ := g.GetPlayer("Alice")
+	bob, _ := g.GetPlayer("Bob")
+	carol, _ := g.GetPlayer("Carol")
+
+	g.SwitchPlayerMap("Alice", 1)
+	welcome := <-alice.GetChannel()
+	assert.Equal(t, KindSystem, welcome.Kind)
+	assert.Equal(t, "Welcome to map 1! You are the first one here.", welcome.Text())
+
+	g.SwitchPlayerMap("Carol", 2)
+	<-carol.GetChannel()
+
+	g.SwitchPlayerMap("Bob", 1)
+	assert.Equal(t, "Welcome to map 1! Players here: Alice", (<-bob.GetChannel()).Text())
+	joined := <-alice.GetChannel()
+	assert.Equal(t, KindJoin, joined.Kind)
+	assert.Equal(t, "Bob joined", joined.Text())
+
+	g.SwitchPlayerMap("Bob", 2)
+	left := <-alice.GetChannel()
+	assert.Equal(t, KindLeave, left.Kind)
+	assert.Equal(t, "Bob left", left.Text())
+	assert.Equal(t, "Bob joined", (<-carol.GetChannel()).Text())
+	assert.Equal(t, "Welcome to map 2! Players here: Carol", (<-bob.GetChannel()).Text())
+
+	g.DisconnectPlayer("Carol")
+	assert.Equal(t, "Carol left", (<-bob.GetChannel()).Text())
+	assert.Len(t, alice.GetChannel(), 0, "players in other maps are not told")
+}
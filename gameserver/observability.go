@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// gameMetrics are the game-wide counters served by WriteMetrics.
+type gameMetrics struct {
+	connects    atomic.Uint64
+	disconnects atomic.Uint64
+	switches    atomic.Uint64
+}
+
+// latencyBuckets are the upper bounds, in seconds, of the fan-out latency histogram.
+var latencyBuckets = []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1}
+
+// histogram counts observations in cumulative buckets, like a Prometheus histogram.
+type histogram struct {
+	mu     sync.Mutex
+	bounds []float64
+	counts []uint64 // counts[i] is the number of observations <= bounds[i]; the last one is +Inf
+	sum    float64
+}
+
+func newHistogram(bounds []float64) *histogram {
+	return &histogram{bounds: bounds, counts: make([]uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, b := range h.bounds {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.counts[len(h.bounds)]++
+	h.sum += v
+}
+
+// snapshot returns a copy of the cumulative counts and the sum.
+func (h *histogram) snapshot() ([]uint64, float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]uint64(nil), h.counts...), h.sum
+}
+
+// mapMetrics is what WriteMetrics reports for one map.
+type mapMetrics struct {
+	id         int
+	players    int
+	queued     int     // messages waiting in the map's channel
+	capacity   int     // size of the map's channel
+	playerFill float64 // fill ratio of the fullest player channel
+	stats      MapStats
+	counts     []uint64
+	sum        float64
+}
+
+// WriteMetrics writes the metrics of the game in the Prometheus text format.
+func (g *Game) WriteMetrics(w io.Writer) error {
+	// 1) Collect everything under the locks, then write without them.
+	g.mu.Lock()
+	connected, away := len(g.players), 0
+	for _, p := range g.players {
+		if p.away {
+			away++
+		}
+	}
+	maps := make([]mapMetrics, 0, len(g.maps))
+	for _, id := range sortedMapIds(g.maps) {
+		m := g.maps[id]
+		m.mu.Lock()
+		mm := mapMetrics{id: id, players: len(m.players), queued: len(m.ch), capacity: cap(m.ch), stats: m.Stats()}
+		for _, p := range m.players {
+			mm.playerFill = max(mm.playerFill, float64(len(p.ch))/float64(cap(p.ch)))
+		}
+		m.mu.Unlock()
+		mm.counts, mm.sum = m.latency.snapshot()
+		maps = append(maps, mm)
+	}
+	g.mu.Unlock()
+
+	// 2) Write them, one family at a time.
+	bw := bufio.NewWriter(w)
+	family := func(name, typ, help string) {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+	}
+	perMap := func(name, typ, help string, value func(mapMetrics) string) {
+		family(name, typ, help)
+		for _, mm := range maps {
+			fmt.Fprintf(bw, "%s{map=\"%d\"} %s\n", name, mm.id, value(mm))
+		}
+	}
+	itoa := func(n int) string { return strconv.Itoa(n) }
+	utoa := func(n uint64) string { return strconv.FormatUint(n, 10) }
+	ftoa := func(f float64) string { return strconv.FormatFloat(f, 'g', -1, 64) }
+
+	family("gameserver_players", "gauge", "Players connected to the game, including away ones.")
+	fmt.Fprintf(bw, "gameserver_players %d\n", connected)
+	family("gameserver_players_away", "gauge", "Players whose connection was lost, waiting to resume their session.")
+	fmt.Fprintf(bw, "gameserver_players_away %d\n", away)
+	family("gameserver_connects_total", "counter", "Players connected since the start.")
+	fmt.Fprintf(bw, "gameserver_connects_total %d\n", g.metrics.connects.Load())
+	family("gameserver_disconnects_total", "counter", "Players disconnected since the start.")
+	fmt.Fprintf(bw, "gameserver_disconnects_total %d\n", g.metrics.disconnects.Load())
+	family("gameserver_map_switches_total", "counter", "Players moved from a map to another since the start.")
+	fmt.Fprintf(bw, "gameserver_map_switches_total %d\n", g.metrics.switches.Load())
+
+	perMap("gameserver_map_players", "gauge", "Players in the map.",
+		func(mm mapMetrics) string { return itoa(mm.players) })
+	perMap("gameserver_map_channel_length", "gauge", "Messages waiting in the map channel.",
+		func(mm mapMetrics) string { return itoa(mm.queued) })
+	perMap("gameserver_map_channel_capacity", "gauge", "Size of the map channel.",
+		func(mm mapMetrics) string { return itoa(mm.capacity) })
+	perMap("gameserver_map_player_channel_fill_max", "gauge", "Fill ratio of the fullest player channel in the map.",
+		func(mm mapMetrics) string { return ftoa(mm.playerFill) })
+	perMap("gameserver_map_messages_sent_total", "counter", "Messages accepted in the map channel.",
+		func(mm mapMetrics) string { return utoa(mm.stats.Sent) })
+	perMap("gameserver_map_messages_delivered_total", "counter", "Copies of messages delivered to players by the fan-out.",
+		func(mm mapMetrics) string { return utoa(mm.stats.Delivered) })
+	perMap("gameserver_map_messages_dropped_total", "counter", "Messages dropped by the map channel or the fan-out.",
+		func(mm mapMetrics) string { return utoa(mm.stats.Dropped) })
+
+	const latency = "gameserver_fanout_latency_seconds"
+	family(latency, "histogram", "Time from the creation of a map message until every player got it.")
+	for _, mm := range maps {
+		for i, b := range latencyBuckets {
+			fmt.Fprintf(bw, "%s_bucket{map=\"%d\",le=\"%s\"} %d\n", latency, mm.id, ftoa(b), mm.counts[i])
+		}
+		inf := mm.counts[len(latencyBuckets)]
+		fmt.Fprintf(bw, "%s_bucket{map=\"%d\",le=\"+Inf\"} %d\n", latency, mm.id, inf)
+		fmt.Fprintf(bw, "%s_sum{map=\"%d\"} %s\n", latency, mm.id, ftoa(mm.sum))
+		fmt.Fprintf(bw, "%s_count{map=\"%d\"} %d\n", latency, mm.id, inf)
+	}
+	return bw.Flush()
+}
+
+// DebugMap is a map in the /debug/game dump.
+type DebugMap struct {
+	MapInfo
+	Queued int      `json:"queued"` // messages waiting in the map channel
+	Stats  MapStats `json:"stats"`
+}
+
+// DebugPlayer is a player in the /debug/game dump.
+type DebugPlayer struct {
+	PlayerInfo
+	Queued int         `json:"queued"` // messages waiting in the player channel
+	Stats  PlayerStats `json:"stats"`
+}
+
+// DebugState is the /debug/game dump of every map and player.
+type DebugState struct {
+	Maps    []DebugMap    `json:"maps"`    // sorted by ID
+	Players []DebugPlayer `json:"players"` // sorted by name
+}
+
+// Debug returns the Snapshot of the game with the queues and counters of every
+// map and player, for troubleshooting.
+func (g *Game) Debug() DebugState {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	snap := g.snapshot()
+	s := DebugState{
+		Maps:    make([]DebugMap, 0, len(snap.Maps)),
+		Players: make([]DebugPlayer, 0, len(snap.Players)),
+	}
+	for _, mi := range snap.Maps {
+		m := g.maps[mi.ID]
+		s.Maps = append(s.Maps, DebugMap{MapInfo: mi, Queued: len(m.ch), Stats: m.Stats()})
+	}
+	for _, pi := range snap.Players {
+		p := g.players[strings.ToLower(pi.Name)]
+		s.Players = append(s.Players, DebugPlayer{PlayerInfo: pi, Queued: len(p.ch), Stats: p.Stats()})
+	}
+	return s
+}
+
+// MetricsHandler serves WriteMetrics.
+func (g *Game) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		g.WriteMetrics(w)
+	})
+}
+
+// DebugHandler serves Debug as JSON.
+func (g *Game) DebugHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(g.Debug())
+	})
+}
+
+// AdminHandler serves /metrics and /debug/game. It is meant for operators:
+// mount it on a port that players cannot reach.
+func (g *Game) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", g.MetricsHandler())
+	mux.Handle("GET /debug/game", g.DebugHandler())
+	return mux
+}
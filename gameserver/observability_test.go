@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// logBuffer collects JSON log lines from several goroutines.
+type logBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// events returns the logged events, decoded.
+func (b *logBuffer) events(t *testing.T) []map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var events []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		var e map[string]any
+		require.NoError(t, json.Unmarshal([]byte(line), &e))
+		delete(e, "time")
+		events = append(events, e)
+	}
+	return events
+}
+
+func TestLogEvents(t *testing.T) {
+	logs := &logBuffer{}
+	g, err := NewGameWithOptions([]int{1, 2}, Options{Logger: slog.New(slog.NewJSONHandler(logs, nil))})
+	require.NoError(t, err)
+
+	require.NoError(t, g.ConnectPlayer("Alice"))
+	require.NoError(t, g.SwitchPlayerMap("Alice", 1))
+	require.NoError(t, g.SwitchPlayerMap("Alice", 2))
+	alice, _ := g.GetPlayer("Alice")
+	// Fill Alice's channel until a notice is dropped.
+	for len(alice.ch) < cap(alice.ch) {
+		alice.deliver(g.newMessage("", 2, KindSystem, "hi"), false)
+	}
+	alice.deliver(g.newMessage("", 2, KindSystem, "hi"), false)
+	require.NoError(t, g.DisconnectPlayer("Alice"))
+
+	assert.Equal(t, []map[string]any{
+		{"level": "INFO", "msg": "player connected", "player": "Alice", "map": 0.0},
+		{"level": "INFO", "msg": "player switched map", "player": "Alice", "from": 0.0, "to": 1.0},
+		{"level": "INFO", "msg": "player switched map", "player": "Alice", "from": 1.0, "to": 2.0},
+		{"level": "WARN", "msg": "message dropped", "player": "Alice", "map": 2.0, "kind": "system", "reason": "player channel is full"},
+		{"level": "INFO", "msg": "player disconnected", "player": "Alice", "map": 2.0},
+	}, logs.events(t))
+}
+
+func TestWriteMetrics(t *testing.T) {
+	g, err := NewGame([]int{1, 2})
+	require.NoError(t, err)
+	g.ConnectPlayer("Alice")
+	g.ConnectPlayer("Bob")
+	g.SwitchPlayerMap("Alice", 1)
+	g.SwitchPlayerMap("Bob", 1)
+	alice, _ := g.GetPlayer("Alice")
+	bob, _ := g.GetPlayer("Bob")
+	require.NoError(t, alice.SendMessage("hello"))
+	for msg := range bob.GetChannel() {
+		if msg.Kind == KindChat {
+			break
+		}
+	}
+
+	// The fan-out counts a delivery just after Bob can read it.
+	assert.EventuallyWithT(t, func(c *assert.CollectT) {
+		var out bytes.Buffer
+		require.NoError(c, g.WriteMetrics(&out))
+		checkMetrics(c, out.String())
+	}, 2*time.Second, time.Millisecond)
+}
+
+func checkMetrics(t assert.TestingT, text string) {
+	for _, line := range []string{
+		"# TYPE gameserver_players gauge",
+		"gameserver_players 2",
+		"gameserver_connects_total 2",
+		"gameserver_map_switches_total 2",
+		`gameserver_map_players{map="1"} 2`,
+		`gameserver_map_players{map="2"} 0`,
+		`gameserver_map_channel_capacity{map="1"} 100`,
+		`gameserver_map_messages_sent_total{map="1"} 3`,      // Bob's join, the chat and Alice's join
+		`gameserver_map_messages_delivered_total{map="1"} 2`, // Bob's join to Alice, the chat to Bob
+		"# TYPE gameserver_fanout_latency_seconds histogram",
+		`gameserver_fanout_latency_seconds_count{map="1"} 3`,
+		`gameserver_fanout_latency_seconds_count{map="2"} 0`,
+	} {
+		assert.Contains(t, text, line+"\n")
+	}
+	assert.Regexp(t, `gameserver_map_player_channel_fill_max\{map="1"\} 0\.0\d+`, text)
+}
+
+func TestHistogram(t *testing.T) {
+	h := newHistogram([]float64{0.1, 1})
+	h.observe(0.05)
+	h.observe(0.5)
+	h.observe(5)
+	counts, sum := h.snapshot()
+	assert.Equal(t, []uint64{1, 2, 3}, counts)
+	assert.InDelta(t, 5.55, sum, 1e-9)
+}
+
+func TestAdminHandler(t *testing.T) {
+	g, err := NewGameWithOptions([]int{1}, Options{ReconnectGrace: time.Minute})
+	require.NoError(t, err)
+	g.AddMap(2, MapOptions{Capacity: 4, Password: "secret", Width: 10, Height: 10})
+	g.ConnectPlayer("Bob")
+	g.ConnectPlayer("Alice")
+	g.SwitchPlayerMap("Alice", 1)
+	bob, _ := g.GetPlayer("Bob")
+	g.detach(bob)
+
+	srv := httptest.NewServer(g.AdminHandler())
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL + "/metrics")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, 200, resp.StatusCode)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", resp.Header.Get("Content-Type"))
+
+	resp, err = srv.Client().Get(srv.URL + "/debug/game")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	var state DebugState
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&state))
+	assert.Equal(t, DebugState{
+		Maps: []DebugMap{
+			{MapInfo: MapInfo{ID: 1, Players: []string{"Alice"}}, Stats: MapStats{ID: 1, Sent: 1}},
+			{MapInfo: MapInfo{ID: 2, Players: []string{}, Capacity: 4, Locked: true, Width: 10, Height: 10}, Stats: MapStats{ID: 2}},
+		},
+		Players: []DebugPlayer{
+			{PlayerInfo: PlayerInfo{Name: "Alice", Map: 1, Position: &Point{}, Presence: Online}, Queued: 1, Stats: PlayerStats{Name: "Alice", Delivered: 1}},
+			{PlayerInfo: PlayerInfo{Name: "Bob", Presence: Away}, Stats: PlayerStats{Name: "Bob"}},
+		},
+	}, state)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+)
+
+// Options configures a Game.
+type Options struct {
+	// Clock is the source of time for rate limits, bans and the tick loop.
+	// Defaults to the system clock.
+	Clock Clock
+	// TickRate is how many times per second every map runs a game tick (see
+	// Map.step). Zero disables the tick loop: the server only relays chat.
+	TickRate int
+	// Logger receives structured events: connections, disconnections, map
+	// switches and dropped messages. Nil discards them.
+	Logger *slog.Logger
+
+	// ReconnectGrace is how long a player whose connection was lost stays in the
+	// game, away, waiting for its client to resume the session (see Game.Resume).
+	// Zero disconnects the player as soon as the connection is lost.
+	ReconnectGrace time.Duration
+
+	// Backpressure is applied to map channels (SendMessage) and player channels (fan-out,
+	// whispers and broadcasts). Only SendMessage and the fan-out wait with
+	// BlockWithTimeout: whispers, broadcasts and server notices are delivered under
+	// the game lock, and never block, whatever the policy.
+	Backpressure BackpressurePolicy
+	// BlockTimeout is how long BlockWithTimeout waits. Defaults to 100ms.
+	BlockTimeout time.Duration
+
+	// HistorySize is how many chat messages every map remembers. Defaults to 100;
+	// a negative value disables the history.
+	HistorySize int
+	// HistoryMaxAge forgets messages older than that. Zero keeps them until they are pushed out.
+	HistoryMaxAge time.Duration
+	// HistoryReplay is how many of the last messages a player gets when joining a map.
+	// Defaults to 10; a negative value disables the replay.
+	HistoryReplay int
+
+	// RateLimit is how many messages per second a player can send on average
+	// (chat and whispers). Zero disables the rate limit.
+	RateLimit float64
+	// RateBurst is how many messages a player can send at once before the rate
+	// limit kicks in. Defaults to 5 when RateLimit is set.
+	RateBurst int
+	// DuplicateWindow rejects a message identical to the previous one sent within that time.
+	// Zero disables duplicate suppression.
+	DuplicateWindow time.Duration
+	// MuteAfter mutes a player automatically after that many rejected messages.
+	// Zero disables automatic mutes.
+	MuteAfter int
+	// MuteDurations are the lengths of the successive automatic mutes of a player;
+	// the last one is reused once they are all used up. Defaults to 30s, 5m and 1h.
+	MuteDurations []time.Duration
+}
+
+// withDefaults fills the zero fields of the options.
+func (o Options) withDefaults() Options {
+	if o.Clock == nil {
+		o.Clock = systemClock{}
+	}
+	if o.Logger == nil {
+		o.Logger = slog.New(slog.DiscardHandler)
+	}
+	if o.BlockTimeout <= 0 {
+		o.BlockTimeout = 100 * time.Millisecond
+	}
+	if o.HistorySize == 0 {
+		o.HistorySize = 100
+	} else if o.HistorySize < 0 {
+		o.HistorySize = 0
+	}
+	if o.HistoryReplay == 0 {
+		o.HistoryReplay = 10
+	}
+	if o.RateLimit > 0 && o.RateBurst <= 0 {
+		o.RateBurst = 5
+	}
+	if len(o.MuteDurations) == 0 {
+		o.MuteDurations = []time.Duration{30 * time.Second, 5 * time.Minute, time.Hour}
+	}
+	return o
+}
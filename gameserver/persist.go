@@ -0,0 +1,161 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// NewGameFromStore creates a game that saves its state in store and restores
+// it from there: the maps, the last map of every player, bans and chat history.
+// mapIds are the maps of a new game, used only when no game was saved in the
+// store yet.
+//
+// Players are not connected after a restart; when they connect again,
+// ConnectPlayer puts them back in the map they were in.
+func NewGameFromStore(store Store, mapIds []int, opts Options) (*Game, error) {
+	state, err := store.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	// 1) A new store: start like NewGame and remember the maps. A saved game
+	// may have no maps left; it is restored like any other.
+	if state.isNew() {
+		g, err := NewGameWithOptions(mapIds, opts)
+		if err != nil {
+			return nil, err
+		}
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		g.store = store
+		g.lastMaps = make(map[string]int)
+		g.persist(Record{Op: OpCreate})
+		for _, id := range sortedMapIds(g.maps) {
+			g.persist(Record{Op: OpMap, Map: id, MapOptions: &MapOptions{}})
+		}
+		return g, nil
+	}
+
+	// 2) Otherwise restore the maps from the store, with their history.
+	// Check them all before starting any goroutine.
+	maps := make([]*Map, 0, len(state.Maps))
+	for id, mo := range state.Maps {
+		m, err := newMap(id, mo)
+		if err != nil {
+			return nil, err
+		}
+		maps = append(maps, m)
+	}
+	g, err := NewGameWithOptions(nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, m := range maps {
+		g.attachMap(m)
+		id := m.id
+		for _, msg := range state.History[id] {
+			m.history.record(msg)
+			bumpMessageID(msg.ID) // message IDs must keep increasing across restarts
+		}
+	}
+
+	// 3) Restore the bans still running and where every player was.
+	now := g.opts.Clock.Now()
+	for key, until := range state.Bans {
+		if until.IsZero() || now.Before(until) {
+			g.bans[key] = until
+		}
+	}
+	g.lastMaps = make(map[string]int, len(state.Players))
+	for name, id := range state.Players {
+		g.lastMaps[strings.ToLower(name)] = id
+	}
+	g.store = store
+	return g, nil
+}
+
+// persist appends rec to the store of the game, if it has one. A failure does
+// not stop the game; it is kept for StoreError.
+func (g *Game) persist(rec Record) {
+	if g.store == nil {
+		return
+	}
+	if err := g.store.Append(rec); err != nil {
+		g.storeMu.Lock()
+		g.storeErr = err
+		g.storeMu.Unlock()
+	}
+}
+
+// queue adds rec to the changes to save, in the order they happened. The
+// caller must hold g.mu, and call flushStore once it has released its locks:
+// the store may write to disk.
+func (g *Game) queue(rec Record) {
+	if g.store == nil {
+		return
+	}
+	g.storeMu.Lock()
+	g.pending = append(g.pending, rec)
+	g.storeMu.Unlock()
+}
+
+// flushStore saves the queued changes. The caller must not hold g.mu or any map lock.
+func (g *Game) flushStore() {
+	// Flushes run one at a time, so the records reach the store in order.
+	g.flushMu.Lock()
+	defer g.flushMu.Unlock()
+	g.storeMu.Lock()
+	recs := g.pending
+	g.pending = nil
+	g.storeMu.Unlock()
+	for _, rec := range recs {
+		g.persist(rec)
+	}
+}
+
+// persistPlayer remembers the map p is in now. The caller must hold g.mu.
+func (g *Game) persistPlayer(p *Player) {
+	if g.store == nil {
+		return
+	}
+	id := 0
+	if p.m != nil {
+		id = p.m.id
+	}
+	// Key the record like g.players, so "Alice" and "ALICE" are the same player.
+	key := strings.ToLower(p.name)
+	g.lastMaps[key] = id
+	g.queue(Record{Op: OpPlayer, Player: key, Map: id})
+}
+
+// StoreError returns the last error writing to the store, or nil.
+func (g *Game) StoreError() error {
+	g.storeMu.Lock()
+	defer g.storeMu.Unlock()
+	return g.storeErr
+}
+
+// restorePlayer puts a player who was in a map before back there, when the game has a store.
+// The caller must hold g.mu.
+func (g *Game) restorePlayer(p *Player) {
+	if g.store == nil {
+		return
+	}
+	if m, ok := g.maps[g.lastMaps[strings.ToLower(p.name)]]; ok && m.checkEntry(m.password) == nil {
+		m.mu.Lock()
+		g.enterMap(p, m)
+		m.mu.Unlock()
+	}
+	g.persistPlayer(p)
+}
+
+func sortedMapIds(maps map[int]*Map) []int {
+	ids := make([]int, 0, len(maps))
+	for id := range maps {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
@@ -0,0 +1,97 @@
+package main
+
+import "strings"
+
+// ConnectEvent is a player connecting. A plugin may change the name.
+type ConnectEvent struct {
+	Name string
+}
+
+// MessageEvent is a player sending a chat message or an action (/me) to its
+// map, or whispering to another player, after the rate limit and the filters.
+// A plugin may rewrite the text.
+type MessageEvent struct {
+	Player string
+	Map    int         // 0 for a whisper
+	To     string      // the receiver of a whisper, empty otherwise
+	Kind   MessageKind // KindChat, KindEmote or KindWhisper
+	Text   string
+}
+
+// SwitchEvent is a player moving to another map with SwitchPlayerMap or /join.
+// From is 0 for a player who is not in a map yet. A plugin may change the
+// destination map.
+type SwitchEvent struct {
+	Player string
+	From   int
+	To     int
+}
+
+// Plugin adds game logic around the events of a game. Each hook may change
+// its event, or return an error to veto it: the error is returned to the
+// caller of ConnectPlayer, SendMessage, Whisper or SwitchPlayerMap, and the
+// event does not happen. Plugins run in the order they were added, each one
+// seeing the event as changed by the previous ones, without any game lock
+// held, so they may call the game.
+//
+// Embed NopPlugin to implement only some of the hooks.
+type Plugin interface {
+	OnConnect(e *ConnectEvent) error
+	OnMessage(e *MessageEvent) error
+	OnSwitch(e *SwitchEvent) error
+}
+
+// NopPlugin is a Plugin whose hooks do nothing.
+type NopPlugin struct{}
+
+func (NopPlugin) OnConnect(*ConnectEvent) error { return nil }
+func (NopPlugin) OnMessage(*MessageEvent) error { return nil }
+func (NopPlugin) OnSwitch(*SwitchEvent) error   { return nil }
+
+// AddPlugin appends pl to the plugins of the game.
+func (g *Game) AddPlugin(pl Plugin) {
+	g.pluginMu.Lock()
+	defer g.pluginMu.Unlock()
+	g.plugins = append(g.plugins, pl)
+}
+
+// switchHooks runs the OnSwitch hooks for a player moving to the map to, and
+// returns the map the player goes to. The player is looked up without holding
+// g.mu during the hooks, so From may be stale by the time the move happens.
+func (g *Game) switchHooks(name string, to int) (int, error) {
+	g.pluginMu.RLock()
+	none := len(g.plugins) == 0
+	g.pluginMu.RUnlock()
+	if none {
+		return to, nil
+	}
+
+	g.mu.Lock()
+	p, ok := g.players[strings.ToLower(name)]
+	from := 0
+	if ok {
+		from = max(p.zone, 0)
+	}
+	g.mu.Unlock()
+	if !ok {
+		return to, nil // SwitchPlayerMap reports the missing player
+	}
+
+	e := &SwitchEvent{Player: p.name, From: from, To: to}
+	err := g.runPlugins(func(pl Plugin) error { return pl.OnSwitch(e) })
+	return e.To, err
+}
+
+// runPlugins calls hook for every plugin, stopping at the first veto.
+func (g *Game) runPlugins(hook func(Plugin) error) error {
+	g.pluginMu.RLock()
+	plugins := g.plugins
+	g.pluginMu.RUnlock()
+
+	for _, pl := range plugins {
+		if err := hook(pl); err != nil {
+			return err
+		}
+	}
+	return nil
+}
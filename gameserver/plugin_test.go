@@ -0,0 +1,108 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var errVetoed = errors.New("vetoed")
+
+// testPlugin bans names starting with "bot", censors "darn", keeps players out
+// of map 2 and sends those going to map 9 to map 1.
+type testPlugin struct {
+	NopPlugin
+	switches []SwitchEvent
+}
+
+func (pl *testPlugin) OnConnect(e *ConnectEvent) error {
+	if strings.HasPrefix(strings.ToLower(e.Name), "bot") {
+		return errVetoed
+	}
+	e.Name = strings.TrimSpace(e.Name)
+	return nil
+}
+
+func (pl *testPlugin) OnMessage(e *MessageEvent) error {
+	e.Text = strings.ReplaceAll(e.Text, "darn", "****")
+	return nil
+}
+
+func (pl *testPlugin) OnSwitch(e *SwitchEvent) error {
+	pl.switches = append(pl.switches, *e)
+	switch e.To {
+	case 2:
+		return errVetoed
+	case 9:
+		e.To = 1
+	}
+	return nil
+}
+
+func TestPluginHooks(t *testing.T) {
+	g, err := NewGame([]int{1, 2})
+	require.NoError(t, err)
+	pl := &testPlugin{}
+	g.AddPlugin(pl)
+
+	assert.ErrorIs(t, g.ConnectPlayer("Bot42"), errVetoed)
+	_, err = g.GetPlayer("Bot42")
+	assert.ErrorIs(t, err, ErrPlayerNotFound)
+	require.NoError(t, g.ConnectPlayer(" Alice "))
+	require.NoError(t, g.ConnectPlayer("Bob"))
+
+	assert.ErrorIs(t, g.SwitchPlayerMap("Alice", 2), errVetoed)
+	assert.Empty(t, g.maps[2].PlayerNames())
+	require.NoError(t, g.SwitchPlayerMap("Alice", 9))
+	require.NoError(t, g.SwitchPlayerMap("Bob", 1))
+	assert.Equal(t, []SwitchEvent{
+		{Player: "Alice", From: 0, To: 2},
+		{Player: "Alice", From: 0, To: 9},
+		{Player: "Bob", From: 0, To: 1},
+	}, pl.switches)
+
+	alice, _ := g.GetPlayer("Alice")
+	bob, _ := g.GetPlayer("Bob")
+	receive(t, bob) // welcome
+	require.NoError(t, alice.SendMessage("darn it"))
+	assert.Equal(t, "**** it", receive(t, bob).Body)
+	require.NoError(t, alice.SendMessage("/me says darn"))
+	assert.Equal(t, "* Alice says ****", receive(t, bob).Text())
+	require.NoError(t, alice.Whisper("Bob", "darn"))
+	assert.Equal(t, "Alice whispers: ****", receive(t, bob).Text())
+
+	// /join goes through the hooks too.
+	assert.ErrorIs(t, alice.SendMessage("/join 2"), errVetoed)
+	assert.Equal(t, SwitchEvent{Player: "Alice", From: 1, To: 2}, pl.switches[len(pl.switches)-1])
+}
+
+// upperPlugin shouts every message, to check that plugins run in order.
+type upperPlugin struct{ NopPlugin }
+
+func (upperPlugin) OnMessage(e *MessageEvent) error {
+	e.Text = strings.ToUpper(e.Text)
+	return nil
+}
+
+func TestPluginOrder(t *testing.T) {
+	g, alice, bob := newCommandGame(t)
+	g.AddPlugin(&testPlugin{})
+	g.AddPlugin(upperPlugin{})
+
+	// "darn" is censored before it is shouted; the other way round it would stay.
+	require.NoError(t, alice.SendMessage("darn"))
+	assert.Equal(t, "****", receive(t, bob).Body)
+	require.NoError(t, alice.SendMessage("hello"))
+	assert.Equal(t, "HELLO", receive(t, bob).Body)
+}
+
+// renamePlugin prefixes the name of every player with "x".
+type renamePlugin struct{ NopPlugin }
+
+func (renamePlugin) OnConnect(e *ConnectEvent) error {
+	e.Name = "x" + e.Name
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// MutedError is returned by SendMessage and Whisper while the player is muted.
+type MutedError struct {
+	Until time.Time // zero when the player is muted until a moderator unmutes them
+	left  time.Duration
+}
+
+func (e *MutedError) Error() string {
+	if e.Until.IsZero() {
+		return "you are muted until a moderator unmutes you"
+	}
+	return "you are muted for " + e.left.Round(time.Second).String()
+}
+
+// Is makes errors.Is(err, ErrMuted) true for every *MutedError.
+func (e *MutedError) Is(target error) bool {
+	return target == ErrMuted
+}
+
+// spamState is the anti-spam bookkeeping of a player.
+type spamState struct {
+	mu sync.Mutex
+
+	tokens float64   // token bucket, refilled at Options.RateLimit per second up to RateBurst
+	refill time.Time // when tokens was last refilled
+
+	last     string    // last accepted message, normalized, for duplicate suppression
+	lastTime time.Time // when it was sent
+
+	strikes    int       // rate and duplicate violations since the last automatic mute
+	level      int       // automatic mutes so far, picks the next entry of MuteDurations
+	muted      bool      // muted by a moderator or automatically
+	mutedUntil time.Time // zero for a mute that lasts until Unmute
+}
+
+// allow runs the anti-spam checks for a message p is about to send, and
+// records it as sent if they pass. A command only goes through the mute and
+// the rate limit: repeating /roll or /who is not spam.
+func (p *Player) allow(msg string, command bool) error {
+	opts := &p.g.opts
+	now := p.g.opts.Clock.Now()
+	s := &p.spam
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 1) Muted players cannot talk until the mute ends.
+	if s.muted {
+		if s.mutedUntil.IsZero() || now.Before(s.mutedUntil) {
+			return s.mutedError(now)
+		}
+		s.muted = false
+	}
+
+	// 2) Token bucket: each message costs a token, and tokens come back over time.
+	if opts.RateLimit > 0 {
+		if s.refill.IsZero() {
+			s.tokens = float64(opts.RateBurst)
+		} else {
+			s.tokens += now.Sub(s.refill).Seconds() * opts.RateLimit
+			if s.tokens > float64(opts.RateBurst) {
+				s.tokens = float64(opts.RateBurst)
+			}
+		}
+		s.refill = now
+		if s.tokens < 1 {
+			return s.strike(opts, now, ErrTooFast)
+		}
+	}
+
+	// 3) The same text twice in a short time is most likely spam.
+	normalized := strings.ToLower(strings.TrimSpace(msg))
+	if !command && opts.DuplicateWindow > 0 && normalized == s.last && now.Sub(s.lastTime) < opts.DuplicateWindow {
+		return s.strike(opts, now, ErrDuplicateMessage)
+	}
+
+	if opts.RateLimit > 0 {
+		s.tokens--
+	}
+	if !command {
+		s.last, s.lastTime = normalized, now
+	}
+	return nil
+}
+
+// strike counts a violation, and mutes the player when there are too many:
+// every automatic mute lasts longer than the previous one. The caller must hold s.mu.
+func (s *spamState) strike(opts *Options, now time.Time, err error) error {
+	if opts.MuteAfter <= 0 {
+		return err
+	}
+	s.strikes++
+	if s.strikes < opts.MuteAfter {
+		return err
+	}
+
+	level := s.level
+	if level >= len(opts.MuteDurations) {
+		level = len(opts.MuteDurations) - 1
+	}
+	s.strikes = 0
+	s.level++
+	s.muted = true
+	s.mutedUntil = now.Add(opts.MuteDurations[level])
+	return s.mutedError(now)
+}
+
+func (s *spamState) mutedError(now time.Time) error {
+	return &MutedError{Until: s.mutedUntil, left: s.mutedUntil.Sub(now)}
+}
+
+// Mute stops a player from sending chat messages and whispers for d, or until
+// Unmute is called if d <= 0, and replaces any mute already in place.
+// by must be a moderator or an admin (see SetRole).
+func (g *Game) Mute(by, name string, d time.Duration) error {
+	p, err := g.moderated(by, name)
+	if err != nil {
+		return err
+	}
+	p.spam.mu.Lock()
+	defer p.spam.mu.Unlock()
+	p.spam.muted = true
+	p.spam.mutedUntil = time.Time{}
+	if d > 0 {
+		p.spam.mutedUntil = g.opts.Clock.Now().Add(d)
+	}
+	return nil
+}
+
+// Unmute lifts the mute of a player, whether a moderator or the anti-spam
+// checks put it in place, and clears the strikes counted toward the next
+// automatic mute. Automatic mutes still get longer each time. by must be a
+// moderator or an admin.
+func (g *Game) Unmute(by, name string) error {
+	p, err := g.moderated(by, name)
+	if err != nil {
+		return err
+	}
+	p.spam.mu.Lock()
+	defer p.spam.mu.Unlock()
+	s := &p.spam
+	if !s.muted || (!s.mutedUntil.IsZero() && !g.opts.Clock.Now().Before(s.mutedUntil)) {
+		return ErrNotMuted
+	}
+	s.muted = false
+	s.strikes = 0
+	return nil
+}
+
+// moderated returns the player name, once the player by is checked to be a
+// moderator or an admin.
+func (g *Game) moderated(by, name string) (*Player, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if err := g.authorize(by, RoleModerator); err != nil {
+		return nil, err
+	}
+	p, ok := g.players[strings.ToLower(name)]
+	if !ok {
+		return nil, ErrPlayerNotFound
+	}
+	return p, nil
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSpamGame(t *testing.T, opts Options) (*Game, *Player, *manualClock) {
+	g, clock := newTestGame(t, []int{1}, opts)
+	return g, join(t, g, "Spammer", 1), clock
+}
+
+func TestRateLimitBurst(t *testing.T) {
+	_, p, clock := newSpamGame(t, Options{RateLimit: 2, RateBurst: 3})
+
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, p.SendMessage("burst"))
+	}
+	assert.Equal(t, ErrTooFast, p.SendMessage("one too many"))
+
+	// Two tokens per second come back, up to the burst.
+	clock.advance(500 * time.Millisecond)
+	assert.NoError(t, p.SendMessage("refilled"))
+	assert.Equal(t, ErrTooFast, p.SendMessage("empty again"))
+
+	clock.advance(time.Minute)
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, p.SendMessage("burst"))
+	}
+	assert.Error(t, p.SendMessage("capped at the burst"))
+	assert.Equal(t, uint64(7), p.Stats().Sent)
+}
+
+func TestRateLimitCommands(t *testing.T) {
+	g, p, clock := newSpamGame(t, Options{RateLimit: 1, RateBurst: 2})
+	join(t, g, "Bob", 1)
+
+	// Commands take tokens like chat, once each, so they cannot flood the map.
+	assert.NoError(t, p.SendMessage("/me waves"))
+	assert.NoError(t, p.SendMessage("/roll"))
+	assert.Equal(t, ErrTooFast, p.SendMessage("/roll"))
+	assert.Equal(t, ErrTooFast, p.SendMessage("/who"))
+
+	clock.advance(time.Second)
+	assert.NoError(t, p.SendMessage("/who"))
+	assert.Equal(t, ErrTooFast, p.SendMessage("hello"))
+}
+
+func TestDuplicateCommands(t *testing.T) {
+	_, p, _ := newSpamGame(t, Options{DuplicateWindow: 10 * time.Second, MuteAfter: 2})
+
+	// Repeating a command is not spam, and does not count toward a mute.
+	for i := 0; i < 3; i++ {
+		assert.NoError(t, p.SendMessage("/roll"))
+		assert.NoError(t, p.SendMessage("/who"))
+	}
+	assert.NoError(t, p.SendMessage("/roll"))
+	assert.NoError(t, p.SendMessage("hi"))
+	assert.Equal(t, ErrDuplicateMessage, p.SendMessage("hi"))
+}
+
+func TestDuplicateSuppression(t *testing.T) {
+	_, p, clock := newSpamGame(t, Options{DuplicateWindow: 10 * time.Second})
+
+	assert.NoError(t, p.SendMessage("buy gold"))
+	assert.Equal(t, ErrDuplicateMessage, p.SendMessage("  BUY GOLD "))
+	assert.NoError(t, p.SendMessage("something else"))
+	assert.NoError(t, p.SendMessage("buy gold"))
+
+	clock.advance(10 * time.Second)
+	assert.NoError(t, p.SendMessage("buy gold"), "the window has passed")
+}
+
+func TestEscalatingMutes(t *testing.T) {
+	g, p, clock := newSpamGame(t, Options{
+		DuplicateWindow: time.Minute,
+		MuteAfter:       2,
+		MuteDurations:   []time.Duration{10 * time.Second, time.Minute},
+	})
+
+	round := 0
+	spam := func() error {
+		round++
+		text := fmt.Sprintf("spam %d", round)
+		assert.NoError(t, p.SendMessage(text))
+		assert.Equal(t, ErrDuplicateMessage, p.SendMessage(text))
+		return p.SendMessage(text)
+	}
+
+	// The second violation mutes the player for the first duration.
+	var muted *MutedError
+	require.True(t, errors.As(spam(), &muted))
+	assert.Equal(t, "you are muted for 10s", muted.Error())
+	clock.advance(4 * time.Second)
+	assert.EqualError(t, p.SendMessage("let me talk"), "you are muted for 6s")
+
+	// The next mute is longer, and the last duration is reused after that.
+	clock.advance(6 * time.Second)
+	require.True(t, errors.As(spam(), &muted))
+	assert.Equal(t, clock.Now().Add(time.Minute), muted.Until)
+	clock.advance(time.Minute)
+	require.True(t, errors.As(spam(), &muted))
+	assert.Equal(t, clock.Now().Add(time.Minute), muted.Until)
+
+	// A moderator can lift an automatic mute.
+	assert.NoError(t, g.Unmute("", "spammer"))
+	assert.NoError(t, p.SendMessage("sorry"))
+	assert.EqualError(t, g.Unmute("", "spammer"), "player is not muted")
+}
+
+func TestModeratorMute(t *testing.T) {
+	g, p, clock := newSpamGame(t, Options{})
+	g.ConnectPlayer("Victim")
+
+	assert.NoError(t, g.Mute("", "Spammer", 0))
+	clock.advance(24 * time.Hour)
+	assert.EqualError(t, p.SendMessage("hello?"), "you are muted until a moderator unmutes you")
+	assert.EqualError(t, p.Whisper("Victim", "hello?"), "you are muted until a moderator unmutes you")
+	assert.NoError(t, g.Unmute("", "Spammer"))
+	assert.NoError(t, p.SendMessage("hello!"))
+
+	// A timed mute ends by itself.
+	assert.NoError(t, g.Mute("", "Spammer", time.Minute))
+	var muted *MutedError
+	assert.True(t, errors.As(p.SendMessage("hi"), &muted))
+	clock.advance(time.Minute)
+	assert.NoError(t, p.SendMessage("hi"))
+	assert.EqualError(t, g.Unmute("", "Spammer"), "player is not muted")
+
+	assert.EqualError(t, g.Mute("", "nobody", time.Minute), "player not found")
+}
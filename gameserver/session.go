@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+)
+
+// Presence tells whether a player is reachable.
+type Presence int
+
+const (
+	Offline Presence = iota // not connected
+	Online                  // connected, with a client attached
+	Away                    // connection lost, waiting for the client to resume the session
+)
+
+func (s Presence) String() string {
+	switch s {
+	case Offline:
+		return "offline"
+	case Online:
+		return "online"
+	case Away:
+		return "away"
+	default:
+		return "unknown"
+	}
+}
+
+// newToken returns a random session token.
+func newToken() string {
+	b := make([]byte, 16)
+	rand.Read(b) // never fails, see crypto/rand.Read
+	return hex.EncodeToString(b)
+}
+
+// SessionToken returns the token issued by ConnectPlayer. A client that loses
+// its connection gives it to Resume to get the same player back.
+func (p *Player) SessionToken() string {
+	return p.token // set once by ConnectPlayer
+}
+
+// Presence returns whether the player is online, away or offline.
+func (g *Game) Presence(name string) Presence {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p, ok := g.players[strings.ToLower(name)]
+	switch {
+	case !ok:
+		return Offline
+	case p.away:
+		return Away
+	default:
+		return Online
+	}
+}
+
+// detach is what front-ends call when the connection of p is lost. With a
+// reconnect grace window (Options.ReconnectGrace), p stays in the game and in
+// its map, away, and its messages wait in its channel until Resume; it is
+// disconnected if no one resumes the session in time. Without one, p is
+// disconnected right away.
+func (g *Game) detach(p *Player) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.players[strings.ToLower(p.name)] != p {
+		return
+	}
+	if g.opts.ReconnectGrace <= 0 {
+		g.removePlayer(p)
+		return
+	}
+	if p.away {
+		return
+	}
+
+	p.away = true
+	p.awayGen++
+	gen := p.awayGen
+	p.awayTimer = g.opts.Clock.AfterFunc(g.opts.ReconnectGrace, func() {
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		// Only expire this absence: the player may have resumed and left again since.
+		if g.players[strings.ToLower(p.name)] == p && p.away && p.awayGen == gen {
+			g.removePlayer(p)
+		}
+	})
+}
+
+// Resume gives back the player of a session token whose connection was lost,
+// with its map and the messages it received while away, which are still in
+// its channel. The token stays valid for the next reconnection.
+func (g *Game) Resume(token string) (*Player, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	p, ok := g.sessions[token]
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	if !p.away {
+		return nil, ErrSessionInUse
+	}
+	p.away = false
+	if p.awayTimer != nil {
+		p.awayTimer.Stop()
+		p.awayTimer = nil
+	}
+	return p, nil
+}
+
+// endSession forgets the session of p. The caller must hold g.mu.
+func (g *Game) endSession(p *Player) {
+	delete(g.sessions, p.token)
+	p.away = false
+	if p.awayTimer != nil {
+		p.awayTimer.Stop()
+		p.awayTimer = nil
+	}
+}
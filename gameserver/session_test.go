@@ -0,0 +1,137 @@
+package main
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSessionGame(t *testing.T) (*Game, *manualClock) {
+	return newTestGame(t, []int{1}, Options{ReconnectGrace: time.Minute})
+}
+
+func TestResumeWithinGrace(t *testing.T) {
+	g, clock := newSessionGame(t)
+	g.ConnectPlayer("Alice")
+	g.ConnectPlayer("Bob")
+	g.SwitchPlayerMap("Alice", 1)
+	g.SwitchPlayerMap("Bob", 1)
+	alice, _ := g.GetPlayer("Alice")
+	bob, _ := g.GetPlayer("Bob")
+	<-bob.GetChannel() // welcome
+	token := bob.SessionToken()
+	assert.Len(t, token, 32)
+	assert.NotEqual(t, token, alice.SessionToken())
+	assert.Equal(t, Online, g.Presence("bob"))
+
+	_, err := g.Resume(token)
+	assert.EqualError(t, err, "session is already in use")
+
+	// Bob's connection drops; he stays in the map and his messages wait for him.
+	g.detach(bob)
+	assert.Equal(t, Away, g.Presence("Bob"))
+	require.NoError(t, alice.SendMessage("are you there?"))
+	clock.advance(59 * time.Second)
+
+	p, err := g.Resume(token)
+	require.NoError(t, err)
+	assert.Same(t, bob, p)
+	assert.Equal(t, Online, g.Presence("Bob"))
+	assert.Equal(t, "Alice says: are you there?", (<-p.GetChannel()).Text())
+	assert.Equal(t, []string{"Alice", "Bob"}, g.maps[1].PlayerNames())
+
+	// The old grace timer does not expire the resumed session.
+	clock.advance(time.Minute)
+	assert.Equal(t, Online, g.Presence("Bob"))
+}
+
+func TestSessionExpires(t *testing.T) {
+	g, clock := newSessionGame(t)
+	g.ConnectPlayer("Bob")
+	bob, _ := g.GetPlayer("Bob")
+	token := bob.SessionToken()
+
+	g.detach(bob)
+	clock.advance(time.Minute)
+	assert.Equal(t, Offline, g.Presence("Bob"))
+	_, open := <-bob.GetChannel()
+	assert.False(t, open)
+	_, err := g.Resume(token)
+	assert.EqualError(t, err, "session not found")
+
+	// A new player gets a new session.
+	require.NoError(t, g.ConnectPlayer("Bob"))
+	again, _ := g.GetPlayer("Bob")
+	assert.NotEqual(t, token, again.SessionToken())
+	assert.Equal(t, "offline", Offline.String())
+	assert.Equal(t, Offline, g.Presence("nobody"))
+}
+
+func TestDetachWithoutGrace(t *testing.T) {
+	g, _ := NewGame([]int{1})
+	g.ConnectPlayer("Bob")
+	bob, _ := g.GetPlayer("Bob")
+	g.detach(bob)
+	assert.Equal(t, Offline, g.Presence("Bob"))
+}
+
+func TestTCPResume(t *testing.T) {
+	g, err := NewGameWithOptions([]int{1}, Options{ReconnectGrace: time.Minute})
+	require.NoError(t, err)
+	s := NewTCPServer(g)
+
+	alice := pipeClient(t, s)
+	bob := pipeClient(t, s)
+	assert.Equal(t, "OK", strings.Fields(alice.send("CONNECT Alice"))[0])
+	reply := bob.send("CONNECT Bob")
+	require.True(t, strings.HasPrefix(reply, "OK "), reply)
+	token := strings.TrimPrefix(reply, "OK ")
+	assert.Equal(t, "OK", alice.send("JOIN 1"))
+	assert.Equal(t, "OK", bob.send("JOIN 1"))
+
+	// Bob's connection is lost without QUIT.
+	bob.conn.Close()
+	require.Eventually(t, func() bool { return g.Presence("Bob") == Away }, 2*time.Second, time.Millisecond)
+	assert.Equal(t, "OK", alice.send("SAY welcome back"))
+
+	again := pipeClient(t, s)
+	assert.Equal(t, "ERR session not found", again.send("RESUME nope"))
+	assert.Equal(t, "OK", again.send("RESUME "+token))
+	assert.Equal(t, "WHO Alice Bob", again.send("WHO"))
+	for {
+		if line := again.msg(); strings.Contains(line, "says:") {
+			assert.Equal(t, "MSG Alice says: welcome back", line)
+			break
+		}
+	}
+	assert.Equal(t, "ERR already connected", again.send("RESUME "+token))
+}
+
+func TestWSResume(t *testing.T) {
+	g, err := NewGameWithOptions([]int{1}, Options{ReconnectGrace: time.Minute})
+	require.NoError(t, err)
+	gw := NewWSGateway(g)
+	srv := httptest.NewServer(gw.Handler())
+	defer srv.Close()
+	defer gw.Close()
+
+	c := dialWS(t, srv, "Alice")
+	_, payload := c.readFrame(t)
+	assert.Contains(t, string(payload), `"type":"session"`)
+	alice, _ := g.GetPlayer("Alice")
+	token := alice.SessionToken()
+	assert.Contains(t, string(payload), token)
+
+	// Dropping the socket without a close handshake leaves Alice away.
+	c.conn.Close()
+	require.Eventually(t, func() bool { return g.Presence("Alice") == Away }, 2*time.Second, time.Millisecond)
+
+	c = dialWS(t, srv, "x&token="+token)
+	c.command(t, `{"type":"join","map":1}`)
+	assert.Equal(t, KindSystem, c.readEvent(t).Kind)
+	assert.Equal(t, Online, g.Presence("Alice"))
+}
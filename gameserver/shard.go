@@ -0,0 +1,509 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/rpc"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A sharded deployment runs one Game per process, a shard node, each owning
+// some of the maps. A Router in front of them knows which node owns which map,
+// and forwards SwitchPlayerMap and SendMessage to the node owning the player's
+// map over net/rpc. A player lives on the node of its map: switching to a map
+// of another node hands it off, with the messages it had not read yet.
+//
+// Chat never crosses nodes: everyone in a map is on the same node. Whispers,
+// broadcasts, roles and bans are local to each node.
+
+// ShardSwitchArgs are the arguments of Shard.Switch and Shard.Accept.
+type ShardSwitchArgs struct {
+	Name     string
+	Map      int
+	Password string
+}
+
+// ShardSendArgs are the arguments of Shard.Send.
+type ShardSendArgs struct {
+	Name string
+	Text string
+}
+
+// ShardPollArgs are the arguments of Shard.Poll.
+type ShardPollArgs struct {
+	Name string
+	Wait time.Duration // how long to wait for a first message
+}
+
+// shardService is the RPC service of a shard node, registered as "Shard".
+// Its methods return their errors through shardError.
+type shardService struct {
+	g    *Game
+	done chan struct{} // closed by ShardNode.Close, ends the polls in progress
+}
+
+// Maps returns the sorted IDs of the maps of the node.
+func (s *shardService) Maps(_ int, reply *[]int) error {
+	s.g.mu.Lock()
+	defer s.g.mu.Unlock()
+	*reply = sortedMapIds(s.g.maps)
+	return nil
+}
+
+// Accept connects a player handed off to this node and puts it in a map, and
+// replies with its name on the node, which a plugin may have changed.
+// If the player cannot enter the map, it is not connected either.
+func (s *shardService) Accept(args ShardSwitchArgs, reply *string) error {
+	p, err := s.g.connect(args.Name)
+	if err != nil {
+		return shardError(err)
+	}
+	if err := s.g.SwitchPlayerMapWithPassword(p.name, args.Map, args.Password); err != nil {
+		s.g.disconnect(p)
+		return shardError(err)
+	}
+	*reply = p.name
+	return nil
+}
+
+// Switch moves a player between two maps of this node.
+func (s *shardService) Switch(args ShardSwitchArgs, _ *bool) error {
+	return shardError(s.g.SwitchPlayerMapWithPassword(args.Name, args.Map, args.Password))
+}
+
+// Send sends a chat message from a player.
+func (s *shardService) Send(args ShardSendArgs, _ *bool) error {
+	p, err := s.g.GetPlayer(args.Name)
+	if err != nil {
+		return shardError(err)
+	}
+	return shardError(p.SendMessage(args.Text))
+}
+
+// Poll returns the messages waiting for a player, waiting up to args.Wait for one.
+func (s *shardService) Poll(args ShardPollArgs, reply *[]Message) error {
+	p, err := s.g.GetPlayer(args.Name)
+	if err != nil {
+		return shardError(err)
+	}
+	t := time.NewTimer(args.Wait)
+	defer t.Stop()
+	select {
+	case msg, ok := <-p.ch:
+		if !ok {
+			return shardError(ErrNotConnected)
+		}
+		*reply = append(*reply, msg)
+	case <-t.C:
+		return nil
+	case <-s.done:
+		return shardError(ErrNodeClosed)
+	}
+	for {
+		select {
+		case msg, ok := <-p.ch:
+			if !ok {
+				return nil
+			}
+			*reply = append(*reply, msg)
+		default:
+			return nil
+		}
+	}
+}
+
+// Release disconnects a player leaving this node, and returns the messages it had not read.
+func (s *shardService) Release(name string, reply *[]Message) error {
+	p, err := s.g.GetPlayer(name)
+	if err != nil {
+		return shardError(err)
+	}
+	if err := s.g.disconnect(p); err != nil {
+		return shardError(err)
+	}
+	// The channel is closed now: read what is left.
+	for msg := range p.ch {
+		*reply = append(*reply, msg)
+	}
+	return nil
+}
+
+// ShardNode serves the maps of a Game to a Router.
+type ShardNode struct {
+	g       *Game
+	l       net.Listener
+	srv     *rpc.Server
+	service *shardService
+
+	mu     sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// ListenShard serves g as a shard node on the TCP address addr, such as
+// "127.0.0.1:0" for a free port on loopback (see Addr).
+func ListenShard(g *Game, addr string) (*ShardNode, error) {
+	srv := rpc.NewServer()
+	service := &shardService{g: g, done: make(chan struct{})}
+	if err := srv.RegisterName("Shard", service); err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	n := &ShardNode{g: g, l: l, srv: srv, service: service, conns: make(map[net.Conn]struct{})}
+	n.wg.Add(1)
+	go n.accept()
+	return n, nil
+}
+
+// Addr returns the address the node listens on.
+func (n *ShardNode) Addr() string {
+	return n.l.Addr().String()
+}
+
+func (n *ShardNode) accept() {
+	defer n.wg.Done()
+	for {
+		conn, err := n.l.Accept()
+		if err != nil {
+			return // the listener was closed
+		}
+		n.mu.Lock()
+		if n.closed {
+			n.mu.Unlock()
+			conn.Close()
+			return
+		}
+		n.conns[conn] = struct{}{}
+		n.wg.Add(1)
+		n.mu.Unlock()
+
+		go func() {
+			defer n.wg.Done()
+			n.srv.ServeConn(conn)
+			n.mu.Lock()
+			delete(n.conns, conn)
+			n.mu.Unlock()
+		}()
+	}
+}
+
+// Close stops the node and closes the connections of the routers. The game keeps running.
+func (n *ShardNode) Close() error {
+	n.mu.Lock()
+	if n.closed {
+		n.mu.Unlock()
+		return nil
+	}
+	n.closed = true
+	close(n.service.done)
+	err := n.l.Close()
+	for conn := range n.conns {
+		conn.Close()
+	}
+	n.mu.Unlock()
+	n.wg.Wait()
+	return err
+}
+
+// routedPlayer is where a Router knows a player to be.
+type routedPlayer struct {
+	mu      sync.Mutex // serializes the switches of the player
+	name    string
+	node    string    // address of the node the player is on, "" before its first map
+	remote  string    // name of the player on that node, see shardService.Accept
+	pending []Message // messages read from the previous node at a handoff, see Poll
+}
+
+// Router sends the players of a sharded game to the nodes owning their maps.
+// It has the same methods as Game for the players, keyed by name.
+type Router struct {
+	mu      sync.Mutex
+	nodes   map[string]*rpc.Client // node address → client
+	owners  map[int]string         // map ID → node address
+	players map[string]*routedPlayer
+}
+
+// NewRouter returns a router without nodes.
+func NewRouter() *Router {
+	return &Router{
+		nodes:   make(map[string]*rpc.Client),
+		owners:  make(map[int]string),
+		players: make(map[string]*routedPlayer),
+	}
+}
+
+// AddNode connects to the shard node at addr and routes its maps to it.
+// It fails if another node already owns one of them.
+func (r *Router) AddNode(addr string) error {
+	client, err := rpc.Dial("tcp", addr)
+	if err != nil {
+		return err
+	}
+	var ids []int
+	if err := client.Call("Shard.Maps", 0, &ids); err != nil {
+		client.Close()
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.nodes[addr]; ok {
+		client.Close()
+		return ErrNodeExists
+	}
+	for _, id := range ids {
+		if owner, ok := r.owners[id]; ok {
+			client.Close()
+			return fmt.Errorf("%w: map %d is owned by %s", ErrMapOwned, id, owner)
+		}
+	}
+	r.nodes[addr] = client
+	for _, id := range ids {
+		r.owners[id] = addr
+	}
+	return nil
+}
+
+// Owner returns the address of the node owning a map.
+func (r *Router) Owner(mapId int) (string, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	addr, ok := r.owners[mapId]
+	return addr, ok
+}
+
+// Maps returns the sorted IDs of the maps of every node.
+func (r *Router) Maps() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ids := make([]int, 0, len(r.owners))
+	for id := range r.owners {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Close closes the connections to the nodes.
+func (r *Router) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var err error
+	for addr, client := range r.nodes {
+		err = errors.Join(err, client.Close())
+		delete(r.nodes, addr)
+	}
+	return err
+}
+
+// ConnectPlayer registers a player. It is created on a node by its first SwitchPlayerMap.
+func (r *Router) ConnectPlayer(name string) error {
+	key := strings.ToLower(name)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.players[key]; ok {
+		return ErrPlayerExists
+	}
+	r.players[key] = &routedPlayer{name: name}
+	return nil
+}
+
+// DisconnectPlayer removes a player from its node and from the router.
+func (r *Router) DisconnectPlayer(name string) error {
+	key := strings.ToLower(name)
+	r.mu.Lock()
+	p, ok := r.players[key]
+	delete(r.players, key)
+	r.mu.Unlock()
+	if !ok {
+		return ErrPlayerNotFound
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.node == "" {
+		return nil
+	}
+	var dropped []Message
+	return r.call(context.Background(), p.node, "Shard.Release", p.remote, &dropped)
+}
+
+func (r *Router) SwitchPlayerMap(name string, mapId int) error {
+	return r.SwitchPlayerMapWithPassword(name, mapId, "")
+}
+
+// SwitchPlayerMapWithPassword moves a player to a map. Within a node the node
+// does the switch. Otherwise the player is handed off: the new node accepts it
+// in the map first, so a failure leaves it where it was, then the old node
+// releases it, and the messages it had not read come first in the next Poll.
+func (r *Router) SwitchPlayerMapWithPassword(name string, mapId int, password string) error {
+	p, err := r.player(name)
+	if err != nil {
+		return err
+	}
+	owner, ok := r.Owner(mapId)
+	if !ok {
+		return ErrMapNotFound
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.node == owner {
+		args := ShardSwitchArgs{Name: p.remote, Map: mapId, Password: password}
+		return r.call(context.Background(), owner, "Shard.Switch", args, new(bool))
+	}
+	var remote string
+	args := ShardSwitchArgs{Name: p.name, Map: mapId, Password: password}
+	if err := r.call(context.Background(), owner, "Shard.Accept", args, &remote); err != nil {
+		return err
+	}
+	if p.node != "" {
+		var unread []Message
+		if err := r.call(context.Background(), p.node, "Shard.Release", p.remote, &unread); err != nil {
+			// The player is on the new node anyway; the old one lost it already.
+			unread = nil
+		}
+		p.pending = append(p.pending, unread...)
+	}
+	p.node, p.remote = owner, remote
+	return nil
+}
+
+// SendMessage sends a chat message from a player to its map.
+func (r *Router) SendMessage(name, text string) error {
+	return r.SendMessageContext(context.Background(), name, text)
+}
+
+// SendMessageContext is like SendMessage, but stops waiting for the node when ctx ends.
+func (r *Router) SendMessageContext(ctx context.Context, name, text string) error {
+	p, err := r.player(name)
+	if err != nil {
+		return err
+	}
+	p.mu.Lock()
+	node, remote := p.node, p.remote
+	p.mu.Unlock()
+	if node == "" {
+		return ErrNotConnected
+	}
+	return r.call(ctx, node, "Shard.Send", ShardSendArgs{Name: remote, Text: text}, new(bool))
+}
+
+// Poll returns the messages waiting for a player, waiting up to wait for one.
+// It plays the role of Player.GetChannel for routed players.
+func (r *Router) Poll(name string, wait time.Duration) ([]Message, error) {
+	return r.PollContext(context.Background(), name, wait)
+}
+
+// PollContext is like Poll, but returns ctx.Err() if ctx ends first.
+func (r *Router) PollContext(ctx context.Context, name string, wait time.Duration) ([]Message, error) {
+	p, err := r.player(name)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	node, remote, msgs := p.node, p.remote, p.pending
+	p.pending = nil
+	p.mu.Unlock()
+	if len(msgs) > 0 || node == "" {
+		return msgs, nil
+	}
+	// A canceled call may still fill its reply later: give it one of its own.
+	var polled []Message
+	err = r.call(ctx, node, "Shard.Poll", ShardPollArgs{Name: remote, Wait: wait}, &polled)
+	if err == nil {
+		return polled, nil
+	}
+	if ctx.Err() == nil {
+		// A handoff during the poll closes the player's channel on the old node:
+		// its messages are pending now.
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		if p.node != node {
+			msgs, p.pending = p.pending, nil
+			return msgs, nil
+		}
+	}
+	return nil, err
+}
+
+func (r *Router) player(name string) (*routedPlayer, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.players[strings.ToLower(name)]
+	if !ok {
+		return nil, ErrPlayerNotFound
+	}
+	return p, nil
+}
+
+// call calls a method of the node at addr, and turns the errors of the node
+// back into the sentinel errors of the package. It stops waiting for the
+// reply when ctx ends; the node may still run the call.
+func (r *Router) call(ctx context.Context, addr, method string, args, reply any) error {
+	r.mu.Lock()
+	client, ok := r.nodes[addr]
+	r.mu.Unlock()
+	if !ok {
+		return ErrNodeNotFound
+	}
+	var err error
+	select {
+	case call := <-client.Go(method, args, reply, make(chan *rpc.Call, 1)).Done:
+		err = call.Error
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	var remote rpc.ServerError
+	if errors.As(err, &remote) {
+		return remoteError(string(remote))
+	}
+	return err
+}
+
+// shardError prepares an error of the node for the Router. net/rpc only carries
+// the text of an error, so the text of the sentinel it matches, if any, goes
+// first as an error code, followed by a tab.
+func shardError(err error) error {
+	if err == nil {
+		return nil
+	}
+	for _, sentinel := range sentinelErrors {
+		if errors.Is(err, sentinel) {
+			return errors.New(sentinel.Error() + "\t" + err.Error())
+		}
+	}
+	return err
+}
+
+// remoteError turns the text of an error from a node back into an error with
+// the same text, matching the sentinel of its error code, see shardError.
+func remoteError(text string) error {
+	code, msg, ok := strings.Cut(text, "\t")
+	if ok {
+		for _, sentinel := range sentinelErrors {
+			if code == sentinel.Error() {
+				return &nodeError{msg: msg, sentinel: sentinel}
+			}
+		}
+	}
+	return errors.New(text)
+}
+
+// nodeError is an error of a shard node, as the Router gets it back.
+type nodeError struct {
+	msg      string
+	sentinel error
+}
+
+func (e *nodeError) Error() string { return e.msg }
+func (e *nodeError) Unwrap() error { return e.sentinel }
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// startShard runs a game with the given maps as a shard node on loopback.
+func startShard(t *testing.T, mapIds ...int) (*Game, *ShardNode) {
+	g, err := NewGame(mapIds)
+	require.NoError(t, err)
+	n, err := ListenShard(g, "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { n.Close() })
+	return g, n
+}
+
+// pollUntil polls a routed player until a message with the given text arrives,
+// and returns every message polled on the way.
+func pollUntil(t *testing.T, r *Router, name, text string) []string {
+	var got []string
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		msgs, err := r.Poll(name, 50*time.Millisecond)
+		require.NoError(t, err)
+		for _, msg := range msgs {
+			got = append(got, msg.Text())
+			if msg.Text() == text {
+				return got
+			}
+		}
+	}
+	t.Fatalf("%s never got %q, got %q", name, text, got)
+	return nil
+}
+
+func TestRouterForwardsToOwner(t *testing.T) {
+	gameA, a := startShard(t, 1, 2)
+	gameB, b := startShard(t, 3)
+	r := NewRouter()
+	defer r.Close()
+	require.NoError(t, r.AddNode(a.Addr()))
+	require.NoError(t, r.AddNode(b.Addr()))
+	assert.Equal(t, []int{1, 2, 3}, r.Maps())
+	owner, ok := r.Owner(3)
+	assert.True(t, ok)
+	assert.Equal(t, b.Addr(), owner)
+
+	require.NoError(t, r.ConnectPlayer("Alice"))
+	require.NoError(t, r.ConnectPlayer("Bob"))
+	assert.EqualError(t, r.ConnectPlayer("alice"), "player already exists")
+	assert.EqualError(t, r.SendMessage("Alice", "hi"), "player is not connected")
+
+	require.NoError(t, r.SwitchPlayerMap("Alice", 3))
+	require.NoError(t, r.SwitchPlayerMap("Bob", 3))
+	assert.Equal(t, []string{"Alice", "Bob"}, gameB.maps[3].PlayerNames())
+	assert.Empty(t, gameA.players)
+
+	require.NoError(t, r.SendMessage("Alice", "hello from shard B"))
+	pollUntil(t, r, "Bob", "Alice says: hello from shard B")
+
+	// A switch within a node stays there.
+	require.NoError(t, r.SwitchPlayerMap("Alice", 1))
+	require.NoError(t, r.SwitchPlayerMap("Alice", 2))
+	assert.Equal(t, []string{"Alice"}, gameA.maps[2].PlayerNames())
+
+	assert.EqualError(t, r.SwitchPlayerMap("Alice", 9), "map not found")
+	assert.EqualError(t, r.SwitchPlayerMap("Alice", 2), "player is already in this map")
+	assert.EqualError(t, r.SendMessage("Nobody", "hi"), "player not found")
+}
+
+func TestRouterHandoff(t *testing.T) {
+	gameA, a := startShard(t, 1)
+	gameB, b := startShard(t, 2)
+	require.NoError(t, gameB.AddMap(3, MapOptions{Password: "secret"}))
+	require.NoError(t, gameB.AddMap(4, MapOptions{Capacity: 1}))
+	r := NewRouter()
+	defer r.Close()
+	require.NoError(t, r.AddNode(a.Addr()))
+	require.NoError(t, r.AddNode(b.Addr()))
+
+	r.ConnectPlayer("Alice")
+	r.ConnectPlayer("Bob")
+	r.ConnectPlayer("Carol")
+	require.NoError(t, r.SwitchPlayerMap("Alice", 1))
+	require.NoError(t, r.SwitchPlayerMap("Bob", 1))
+	require.NoError(t, r.SwitchPlayerMap("Carol", 4))
+
+	// Bob talks; Alice moves to the other node before reading it.
+	require.NoError(t, r.SendMessage("Bob", "see you there"))
+	require.Eventually(t, func() bool {
+		alice, err := gameA.GetPlayer("Alice")
+		return err == nil && len(alice.ch) == 3 // welcome, Bob's join and the chat
+	}, 2*time.Second, time.Millisecond)
+
+	// A map of the other node that refuses Alice leaves her where she was.
+	assert.ErrorIs(t, r.SwitchPlayerMap("Alice", 4), ErrMapFull)
+	assert.ErrorIs(t, r.SwitchPlayerMapWithPassword("Alice", 3, "nope"), ErrWrongPassword)
+	assert.Equal(t, []string{"Alice", "Bob"}, gameA.maps[1].PlayerNames())
+	_, err := gameB.GetPlayer("Alice")
+	assert.Error(t, err)
+
+	require.NoError(t, r.SwitchPlayerMapWithPassword("Alice", 3, "secret"))
+	assert.Equal(t, []string{"Bob"}, gameA.maps[1].PlayerNames())
+	assert.Equal(t, []string{"Alice"}, gameB.maps[3].PlayerNames())
+
+	// The messages of the old node come first, then those of the new one.
+	got := pollUntil(t, r, "Alice", "Welcome to map 3! You are the first one here.")
+	assert.Equal(t, []string{
+		"Welcome to map 1! You are the first one here.",
+		"Bob joined",
+		"Bob says: see you there",
+		"Welcome to map 3! You are the first one here.",
+	}, got)
+	pollUntil(t, r, "Bob", "Alice left")
+
+	// Disconnecting removes the player from its node.
+	require.NoError(t, r.DisconnectPlayer("Alice"))
+	_, err = gameB.GetPlayer("Alice")
+	assert.Error(t, err)
+	assert.EqualError(t, r.DisconnectPlayer("Alice"), "player not found")
+}
+
+func TestRouterRejectsOverlappingNodes(t *testing.T) {
+	_, a := startShard(t, 1, 2)
+	_, b := startShard(t, 2, 3)
+	r := NewRouter()
+	defer r.Close()
+	require.NoError(t, r.AddNode(a.Addr()))
+	err := r.AddNode(b.Addr())
+	assert.ErrorIs(t, err, ErrMapOwned)
+	assert.EqualError(t, err, "map is already owned by another node: map 2 is owned by "+a.Addr())
+	assert.EqualError(t, r.AddNode(a.Addr()), "node is already added")
+	assert.Equal(t, []int{1, 2}, r.Maps())
+}
+
+func TestRouterRenamedOnNode(t *testing.T) {
+	_, a := startShard(t, 1)
+	gameB, b := startShard(t, 2, 3)
+	gameB.AddPlugin(renamePlugin{})
+	r := NewRouter()
+	defer r.Close()
+	require.NoError(t, r.AddNode(a.Addr()))
+	require.NoError(t, r.AddNode(b.Addr()))
+
+	// Node B renames Alice at the handoff; the router keeps using her name there.
+	r.ConnectPlayer("Alice")
+	require.NoError(t, r.SwitchPlayerMap("Alice", 1))
+	require.NoError(t, r.SwitchPlayerMap("Alice", 2))
+	assert.Equal(t, []string{"xAlice"}, gameB.maps[2].PlayerNames())
+	require.NoError(t, r.SwitchPlayerMap("Alice", 3))
+	assert.Equal(t, []string{"xAlice"}, gameB.maps[3].PlayerNames())
+	pollUntil(t, r, "Alice", "Welcome to map 3! You are the first one here.")
+	require.NoError(t, r.SendMessage("Alice", "hi"))
+
+	require.NoError(t, r.DisconnectPlayer("Alice"))
+	_, err := gameB.GetPlayer("xAlice")
+	assert.ErrorIs(t, err, ErrPlayerNotFound)
+}
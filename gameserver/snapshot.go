@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// MapInfo describes a map in a GameSnapshot.
+type MapInfo struct {
+	ID         int      `json:"id"`
+	Players    []string `json:"players"` // display names, sorted
+	Capacity   int      `json:"capacity,omitempty"`
+	Locked     bool     `json:"locked,omitempty"` // the map has a password
+	Width      int      `json:"width,omitempty"`
+	Height     int      `json:"height,omitempty"`
+	ChatRadius float64  `json:"chatRadius,omitempty"`
+	Tick       uint64   `json:"tick"`
+}
+
+// PlayerInfo describes a player in a GameSnapshot.
+type PlayerInfo struct {
+	Name     string   `json:"name"`
+	Map      int      `json:"map"`                // 0 for no map
+	Position *Point   `json:"position,omitempty"` // nil when not in a map
+	Role     Role     `json:"role"`
+	Presence Presence `json:"presence"`
+}
+
+// GameSnapshot is a copy of the state of a game at one point in time. It
+// shares nothing with the game, so it can be kept and read without locks.
+type GameSnapshot struct {
+	Maps    []MapInfo    `json:"maps"`    // sorted by ID
+	Players []PlayerInfo `json:"players"` // sorted by name
+	Closed  bool         `json:"closed"`  // the game was shut down
+}
+
+// Snapshot returns the maps and players of the game.
+func (g *Game) Snapshot() GameSnapshot {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.snapshot()
+}
+
+// snapshot is Snapshot for callers holding g.mu.
+func (g *Game) snapshot() GameSnapshot {
+	s := GameSnapshot{Maps: []MapInfo{}, Players: []PlayerInfo{}, Closed: g.closed}
+	positions := make(map[*Player]Point)
+	for _, id := range sortedMapIds(g.maps) {
+		m := g.maps[id]
+		m.mu.Lock()
+		mi := MapInfo{
+			ID:         id,
+			Players:    make([]string, 0, len(m.players)),
+			Capacity:   m.capacity,
+			Locked:     m.password != "",
+			Width:      m.width,
+			Height:     m.height,
+			ChatRadius: m.chatRadius,
+			Tick:       m.tick,
+		}
+		for _, p := range m.players {
+			mi.Players = append(mi.Players, p.name)
+			positions[p] = p.pos
+		}
+		m.mu.Unlock()
+		sort.Strings(mi.Players)
+		s.Maps = append(s.Maps, mi)
+	}
+
+	for _, p := range g.players {
+		pi := PlayerInfo{Name: p.name, Map: max(p.zone, 0), Role: p.role, Presence: Online}
+		if p.away {
+			pi.Presence = Away
+		}
+		if pos, ok := positions[p]; ok {
+			pi.Position = &pos
+		}
+		s.Players = append(s.Players, pi)
+	}
+	sort.Slice(s.Players, func(i, j int) bool { return s.Players[i].Name < s.Players[j].Name })
+	return s
+}
+
+// MarshalText encodes the role by its name, as in JSON snapshots.
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Role) UnmarshalText(text []byte) error {
+	for role := RolePlayer; role <= RoleAdmin; role++ {
+		if strings.EqualFold(string(text), role.String()) {
+			*r = role
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown role %q", text)
+}
+
+// MarshalText encodes the presence by its name, as in JSON snapshots.
+func (s Presence) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+func (s *Presence) UnmarshalText(text []byte) error {
+	for presence := Offline; presence <= Away; presence++ {
+		if strings.EqualFold(string(text), presence.String()) {
+			*s = presence
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown presence %q", text)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+	g, err := NewGameWithOptions([]int{1}, Options{ReconnectGrace: time.Minute})
+	require.NoError(t, err)
+	require.NoError(t, g.AddMap(2, MapOptions{Capacity: 2, Password: "secret", Spawn: Point{3, 4}}))
+	g.ConnectPlayer("Bob")
+	g.ConnectPlayer("Alice")
+	g.SwitchPlayerMapWithPassword("Alice", 2, "secret")
+	g.SetRole("", "Alice", RoleModerator)
+	bob, _ := g.GetPlayer("Bob")
+	g.detach(bob)
+
+	snap := g.Snapshot()
+	assert.Equal(t, GameSnapshot{
+		Maps: []MapInfo{
+			{ID: 1, Players: []string{}},
+			{ID: 2, Players: []string{"Alice"}, Capacity: 2, Locked: true},
+		},
+		Players: []PlayerInfo{
+			{Name: "Alice", Map: 2, Position: &Point{3, 4}, Role: RoleModerator, Presence: Online},
+			{Name: "Bob", Role: RolePlayer, Presence: Away},
+		},
+	}, snap)
+
+	// The snapshot does not change with the game.
+	g.SwitchPlayerMap("Alice", 1)
+	assert.Equal(t, []string{"Alice"}, snap.Maps[1].Players)
+	assert.Equal(t, 2, snap.Players[0].Map)
+
+	data, err := json.Marshal(snap.Players[0])
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name":"Alice","map":2,"position":{"x":3,"y":4},"role":"moderator","presence":"online"}`, string(data))
+	var decoded PlayerInfo
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, snap.Players[0], decoded)
+	assert.Error(t, json.Unmarshal([]byte(`{"role":"king"}`), &decoded))
+
+	require.NoError(t, g.Shutdown(context.Background()))
+	assert.True(t, g.Snapshot().Closed)
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+)
+
+var (
+	// ErrOutOfBounds is returned when a player tries to move outside its map.
+	ErrOutOfBounds = errors.New("position is out of bounds")
+	// ErrBlocked is returned when a player tries to move onto an obstacle.
+	ErrBlocked = errors.New("position is blocked")
+)
+
+// Point is a position in a map. X grows to the right and Y downwards.
+type Point struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// within reports whether q is at most radius away from p.
+func (p Point) within(q Point, radius float64) bool {
+	dx, dy := float64(q.X-p.X), float64(q.Y-p.Y)
+	return dx*dx+dy*dy <= radius*radius
+}
+
+// defaultCellSize is the grid cell size of maps without proximity chat.
+const defaultCellSize = 16
+
+// grid is a spatial index of the players of a map: the plane is cut into
+// square cells, so finding the players around a point only looks at the few
+// cells that overlap the search area instead of every player. It is guarded
+// by the map lock.
+type grid struct {
+	size  int
+	cells map[Point]map[*Player]struct{} // cell coordinates → players in the cell
+}
+
+func newGrid(size int) *grid {
+	return &grid{size: size, cells: make(map[Point]map[*Player]struct{})}
+}
+
+// cell returns the coordinates of the cell holding pt.
+func (gr *grid) cell(pt Point) Point {
+	return Point{floorDiv(pt.X, gr.size), floorDiv(pt.Y, gr.size)}
+}
+
+func floorDiv(a, b int) int {
+	q := a / b
+	if a%b != 0 && a < 0 {
+		q--
+	}
+	return q
+}
+
+func (gr *grid) add(p *Player, pt Point) {
+	c := gr.cell(pt)
+	if gr.cells[c] == nil {
+		gr.cells[c] = make(map[*Player]struct{})
+	}
+	gr.cells[c][p] = struct{}{}
+}
+
+func (gr *grid) remove(p *Player, pt Point) {
+	c := gr.cell(pt)
+	delete(gr.cells[c], p)
+	if len(gr.cells[c]) == 0 {
+		delete(gr.cells, c)
+	}
+}
+
+func (gr *grid) move(p *Player, from, to Point) {
+	if gr.cell(from) != gr.cell(to) {
+		gr.remove(p, from)
+		gr.add(p, to)
+	}
+}
+
+// validRadius reports whether radius can be searched: not negative, infinite or NaN.
+func validRadius(radius float64) bool {
+	return radius >= 0 && !math.IsInf(radius, 1)
+}
+
+// within returns the players at most radius away from center, or none for an
+// invalid radius.
+func (gr *grid) within(center Point, radius float64) []*Player {
+	if !validRadius(radius) {
+		return nil
+	}
+	var found []*Player
+	visit := func(players map[*Player]struct{}) {
+		for p := range players {
+			if center.within(p.pos, radius) {
+				found = append(found, p)
+			}
+		}
+	}
+
+	// Look at the cells overlapping the search area, or at the occupied cells
+	// when there are fewer of those: a huge radius must not loop over billions
+	// of empty cells.
+	side := 2*radius/float64(gr.size) + 2 // cells on a side of the area, at most
+	if side*side >= float64(len(gr.cells)) {
+		for _, players := range gr.cells {
+			visit(players)
+		}
+		return found
+	}
+	r := int(math.Ceil(radius))
+	lo := gr.cell(Point{center.X - r, center.Y - r})
+	hi := gr.cell(Point{center.X + r, center.Y + r})
+	for cx := lo.X; cx <= hi.X; cx++ {
+		for cy := lo.Y; cy <= hi.Y; cy++ {
+			visit(gr.cells[Point{cx, cy}])
+		}
+	}
+	return found
+}
+
+// checkPosition reports whether a player can stand at pt.
+func (m *Map) checkPosition(pt Point) error {
+	if pt.X < 0 || pt.Y < 0 ||
+		(m.width > 0 && pt.X >= m.width) ||
+		(m.height > 0 && pt.Y >= m.height) {
+		return ErrOutOfBounds
+	}
+	if _, ok := m.obstacles[pt]; ok {
+		return ErrBlocked
+	}
+	return nil
+}
+
+// place puts p at the spawn point of m. The caller must hold m.mu.
+func (m *Map) place(p *Player) {
+	p.pos = m.spawn
+	m.grid.add(p, p.pos)
+}
+
+// leave removes p from m. The caller must hold g.mu and m.mu.
+func (m *Map) leave(p *Player) {
+	delete(m.players, strings.ToLower(p.name))
+	m.grid.remove(p, p.pos)
+}
+
+// Move moves the player by (dx, dy) in its map. It returns ErrOutOfBounds or
+// ErrBlocked, and leaves the player where it was, if it cannot stand there.
+func (p *Player) Move(dx, dy int) error {
+	g := p.g
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	m := p.m
+	if m == nil {
+		return ErrNotInMap
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	to := Point{p.pos.X + dx, p.pos.Y + dy}
+	if err := m.checkPosition(to); err != nil {
+		return err
+	}
+	m.grid.move(p, p.pos, to)
+	p.pos = to
+	return nil
+}
+
+// Position returns the position of the player in its map, and false if it is not in a map.
+func (p *Player) Position() (Point, bool) {
+	p.g.mu.Lock()
+	defer p.g.mu.Unlock()
+	m := p.m
+	if m == nil {
+		return Point{}, false
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return p.pos, true
+}
+
+// PlayersWithin returns the sorted names of the players at most radius away from center.
+// A negative, infinite or NaN radius finds no one.
+func (m *Map) PlayersWithin(center Point, radius float64) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var names []string
+	for _, p := range m.grid.within(center, radius) {
+		names = append(names, displayName(p.name))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// audience returns the players who should receive msg: everyone in the map,
+// or, for chat in a map with proximity chat, the players close enough to the
+// sender. Proximity chat from a sender who already left the map reaches no one.
+// The caller must hold m.mu.
+func (m *Map) audience(msg Message) []*Player {
+	if m.chatRadius > 0 && (msg.Kind == KindChat || msg.Kind == KindEmote) {
+		sender, ok := m.players[msg.senderKey()]
+		if !ok {
+			return nil
+		}
+		return m.grid.within(sender.pos, m.chatRadius)
+	}
+
+	all := make([]*Player, 0, len(m.players))
+	for _, p := range m.players {
+		all = append(all, p)
+	}
+	return all
+}
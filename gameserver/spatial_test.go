@@ -0,0 +1,135 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGridMatchesBruteForce(t *testing.T) {
+	gr := newGrid(8)
+	r := rand.New(rand.NewSource(1))
+	players := make([]*Player, 2000)
+	for i := range players {
+		players[i] = &Player{name: fmt.Sprint(i), pos: Point{r.Intn(400) - 200, r.Intn(400) - 200}}
+		gr.add(players[i], players[i].pos)
+	}
+	// Move some of them around, across cells.
+	for _, p := range players[:500] {
+		to := Point{p.pos.X + r.Intn(50) - 25, p.pos.Y + r.Intn(50) - 25}
+		gr.move(p, p.pos, to)
+		p.pos = to
+	}
+
+	for _, q := range []struct {
+		center Point
+		radius float64
+	}{
+		{Point{0, 0}, 10}, {Point{-100, 37}, 25.5}, {Point{199, -199}, 3}, {Point{5, 5}, 0},
+		// Huge areas look at the occupied cells instead of every cell of the area.
+		{Point{0, 0}, 150}, {Point{0, 0}, 1e9}, {Point{0, 0}, math.MaxFloat64},
+	} {
+		var want, got []string
+		for _, p := range players {
+			if q.center.within(p.pos, q.radius) {
+				want = append(want, p.name)
+			}
+		}
+		for _, p := range gr.within(q.center, q.radius) {
+			got = append(got, p.name)
+		}
+		sort.Strings(want)
+		sort.Strings(got)
+		assert.Equal(t, want, got, "%+v", q)
+	}
+
+	// Invalid radiuses find no one.
+	for _, radius := range []float64{-1, math.NaN(), math.Inf(1), math.Inf(-1)} {
+		assert.Empty(t, gr.within(Point{0, 0}, radius), radius)
+	}
+	_, err := newMap(1, MapOptions{ChatRadius: math.NaN()})
+	assert.ErrorIs(t, err, ErrInvalidMapOptions)
+	_, err = newMap(1, MapOptions{ChatRadius: math.Inf(1)})
+	assert.ErrorIs(t, err, ErrInvalidMapOptions)
+	m, err := newMap(1, MapOptions{ChatRadius: 1e300})
+	require.NoError(t, err)
+	assert.Equal(t, math.MaxInt32, m.grid.size)
+}
+
+func TestMove(t *testing.T) {
+	g, _ := NewGame([]int{1})
+	require.NoError(t, g.AddMap(2, MapOptions{
+		Width: 10, Height: 5,
+		Spawn:     Point{1, 1},
+		Obstacles: []Point{{2, 1}},
+	}))
+	g.ConnectPlayer("Alice")
+	alice, _ := g.GetPlayer("Alice")
+
+	assert.EqualError(t, alice.Move(1, 0), "player is not in a map")
+	_, ok := alice.Position()
+	assert.False(t, ok)
+
+	g.SwitchPlayerMap("Alice", 2)
+	pos, _ := alice.Position()
+	assert.Equal(t, Point{1, 1}, pos)
+
+	assert.ErrorIs(t, alice.Move(1, 0), ErrBlocked)
+	assert.ErrorIs(t, alice.Move(-2, 0), ErrOutOfBounds)
+	assert.ErrorIs(t, alice.Move(0, 4), ErrOutOfBounds)
+	assert.NoError(t, alice.Move(8, 3))
+	pos, _ = alice.Position()
+	assert.Equal(t, Point{9, 4}, pos)
+
+	// Map 1 has no bounds on the far side, and players start at the origin.
+	g.SwitchPlayerMap("Alice", 1)
+	assert.NoError(t, alice.Move(1000, 1000))
+	pos, _ = alice.Position()
+	assert.Equal(t, Point{1000, 1000}, pos)
+
+	assert.EqualError(t, g.AddMap(3, MapOptions{Obstacles: []Point{{0, 0}}}), "map options are invalid: spawn point: position is blocked")
+	assert.EqualError(t, g.AddMap(3, MapOptions{Width: -1}), "map options are invalid: negative size or invalid chat radius")
+}
+
+func TestProximityChat(t *testing.T) {
+	g, _ := NewGame(nil)
+	require.NoError(t, g.AddMap(1, MapOptions{ChatRadius: 5}))
+	for _, name := range []string{"Alice", "Bob", "Cyn"} {
+		g.ConnectPlayer(name)
+		g.SwitchPlayerMap(name, 1)
+	}
+	alice, _ := g.GetPlayer("Alice")
+	bob, _ := g.GetPlayer("Bob")
+	cyn, _ := g.GetPlayer("Cyn")
+	require.NoError(t, bob.Move(3, 4))  // exactly 5 away from Alice
+	require.NoError(t, cyn.Move(30, 0)) // out of range
+	assert.Equal(t, []string{"Alice", "Bob"}, g.maps[1].PlayersWithin(Point{0, 0}, 5))
+
+	// Bob only hears Alice; Cyn hears no one.
+	require.NoError(t, cyn.SendMessage("anyone?"))
+	require.NoError(t, alice.SendMessage("psst"))
+	for msg := range bob.GetChannel() {
+		if msg.Kind == KindChat {
+			assert.Equal(t, "Alice says: psst", msg.Text())
+			break
+		}
+	}
+	// Alice's message went through the map after Cyn's, so Cyn's was handled by now.
+	require.NoError(t, g.Broadcast("server notices reach everyone"))
+	for {
+		msg := <-cyn.GetChannel()
+		assert.NotEqual(t, KindChat, msg.Kind, msg.Text())
+		if msg.Text() == "server notices reach everyone" {
+			break
+		}
+	}
+
+	// Proximity chat stays out of the history.
+	msgs, _ := g.maps[1].History(0, 0)
+	assert.Empty(t, msgs)
+}
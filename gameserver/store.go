@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Store keeps the state of a Game across restarts: its maps, the last map of
+// every player, bans and chat history. The game appends a Record for every
+// change, and NewGameFromStore loads the state back at startup.
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Append records a change.
+	Append(rec Record) error
+	// Load returns the state built from every record appended so far.
+	Load() (*GameState, error)
+	// Close releases the resources of the store.
+	Close() error
+}
+
+// RecordOp is the kind of change a Record describes.
+type RecordOp string
+
+const (
+	OpCreate  RecordOp = "create"  // the game was created; its first maps follow
+	OpMap     RecordOp = "map"     // a map was created with Record.MapOptions
+	OpUnmap   RecordOp = "unmap"   // a map was removed
+	OpPlayer  RecordOp = "player"  // a player connected or moved to Record.Map (0 for no map)
+	OpBan     RecordOp = "ban"     // a name was banned until Record.Until (zero for forever)
+	OpUnban   RecordOp = "unban"   // a ban was lifted
+	OpMessage RecordOp = "message" // Record.Message was said in its map
+)
+
+// Record is a single change of the game state.
+type Record struct {
+	Op         RecordOp    `json:"op"`
+	Map        int         `json:"map,omitempty"`
+	MapOptions *MapOptions `json:"mapOptions,omitempty"`
+	Player     string      `json:"player,omitempty"`
+	Until      time.Time   `json:"until,omitzero"`
+	Message    *Message    `json:"message,omitempty"`
+}
+
+// GameState is what a Store remembers of a game.
+type GameState struct {
+	Created bool                 `json:"created,omitempty"` // an OpCreate record was appended
+	Maps    map[int]MapOptions   `json:"maps"`
+	Players map[string]int       `json:"players"` // lowercase name → last map, 0 for none
+	Bans    map[string]time.Time `json:"bans"`    // lowercase name → end of the ban, zero for forever
+	History map[int][]Message    `json:"history"` // map → recent chat, oldest first
+}
+
+// storedHistory is how many chat messages per map a store keeps.
+const storedHistory = 100
+
+func newGameState() *GameState {
+	return &GameState{
+		Maps:    make(map[int]MapOptions),
+		Players: make(map[string]int),
+		Bans:    make(map[string]time.Time),
+		History: make(map[int][]Message),
+	}
+}
+
+// isNew reports whether no game was ever saved in the state. Stores written
+// before OpCreate existed count as new only when they hold nothing at all.
+func (s *GameState) isNew() bool {
+	return !s.Created && len(s.Maps) == 0 && len(s.Players) == 0 && len(s.Bans) == 0 && len(s.History) == 0
+}
+
+// check returns an error for a record that apply would reject.
+func (rec Record) check() error {
+	switch rec.Op {
+	case OpCreate, OpUnmap, OpPlayer, OpBan, OpUnban:
+	case OpMap:
+		if rec.MapOptions == nil {
+			return errors.New("map record without options")
+		}
+	case OpMessage:
+		if rec.Message == nil {
+			return errors.New("message record without message")
+		}
+	default:
+		return fmt.Errorf("unknown record op %q", rec.Op)
+	}
+	return nil
+}
+
+// apply updates the state with a record.
+func (s *GameState) apply(rec Record) error {
+	if err := rec.check(); err != nil {
+		return err
+	}
+	switch rec.Op {
+	case OpCreate:
+		s.Created = true
+	case OpMap:
+		s.Maps[rec.Map] = *rec.MapOptions
+	case OpUnmap:
+		delete(s.Maps, rec.Map)
+		delete(s.History, rec.Map)
+	case OpPlayer:
+		s.Players[rec.Player] = rec.Map
+	case OpBan:
+		s.Bans[rec.Player] = rec.Until
+	case OpUnban:
+		delete(s.Bans, rec.Player)
+	case OpMessage:
+		h := append(s.History[rec.Message.Map], *rec.Message)
+		if len(h) > storedHistory {
+			h = h[len(h)-storedHistory:]
+		}
+		s.History[rec.Message.Map] = h
+	}
+	return nil
+}
+
+// clone returns a deep copy of the state, so callers can use it without locks.
+func (s *GameState) clone() *GameState {
+	c := newGameState()
+	c.Created = s.Created
+	for id, opts := range s.Maps {
+		c.Maps[id] = opts
+	}
+	for name, id := range s.Players {
+		c.Players[name] = id
+	}
+	for name, until := range s.Bans {
+		c.Bans[name] = until
+	}
+	for id, msgs := range s.History {
+		c.History[id] = append([]Message(nil), msgs...)
+	}
+	return c
+}
+
+// MemoryStore is a Store that only lives as long as the process. It is meant
+// for tests, and for restarting a Game within the same process.
+type MemoryStore struct {
+	mu    sync.Mutex
+	state *GameState
+}
+
+// NewMemoryStore returns an empty MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{state: newGameState()}
+}
+
+func (s *MemoryStore) Append(rec Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.apply(rec)
+}
+
+func (s *MemoryStore) Load() (*GameState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.clone(), nil
+}
+
+func (s *MemoryStore) Close() error { return nil }
+
+// FileStore is a Store backed by two files in a directory:
+//
+//	state.json   the state at the last compaction, as a JSON GameState
+//	log.jsonl    every record appended since, one JSON object per line
+//
+// Appending only writes a line at the end of the log, so a crash loses at most
+// the record being written; a torn last line is ignored when loading. Compact
+// folds the log into state.json to keep loading fast.
+type FileStore struct {
+	dir string
+
+	mu    sync.Mutex
+	log   *os.File
+	state *GameState // state.json plus the log, kept up to date
+}
+
+const (
+	stateFile = "state.json"
+	logFile   = "log.jsonl"
+)
+
+// OpenFileStore opens the store in dir, creating the directory if needed.
+func OpenFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	s := &FileStore{dir: dir, state: newGameState()}
+
+	// 1) Read the last compacted state, if any.
+	data, err := os.ReadFile(filepath.Join(dir, stateFile))
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, s.state); err != nil {
+			return nil, fmt.Errorf("read %s: %w", stateFile, err)
+		}
+		s.fillNilMaps()
+	case !errors.Is(err, os.ErrNotExist):
+		return nil, err
+	}
+
+	// 2) Replay the log on top of it.
+	log, err := os.OpenFile(filepath.Join(dir, logFile), os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	valid, err := s.replay(log)
+	if err != nil {
+		log.Close()
+		return nil, err
+	}
+
+	// 3) Drop a torn last line, then append after the last valid record.
+	if err := log.Truncate(valid); err != nil {
+		log.Close()
+		return nil, err
+	}
+	if _, err := log.Seek(valid, io.SeekStart); err != nil {
+		log.Close()
+		return nil, err
+	}
+	s.log = log
+	return s, nil
+}
+
+// replay applies the records of the log and returns the size of its valid part.
+func (s *FileStore) replay(log *os.File) (int64, error) {
+	r := bufio.NewReader(log)
+	var valid int64
+	for line := 1; ; line++ {
+		data, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// A line without a newline was cut short by a crash.
+			return valid, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		var rec Record
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return 0, fmt.Errorf("%s line %d: %w", logFile, line, err)
+		}
+		if err := s.state.apply(rec); err != nil {
+			return 0, fmt.Errorf("%s line %d: %w", logFile, line, err)
+		}
+		valid += int64(len(data))
+	}
+}
+
+// fillNilMaps makes sure a decoded state has no nil maps.
+func (s *FileStore) fillNilMaps() {
+	empty := newGameState()
+	if s.state.Maps == nil {
+		s.state.Maps = empty.Maps
+	}
+	if s.state.Players == nil {
+		s.state.Players = empty.Players
+	}
+	if s.state.Bans == nil {
+		s.state.Bans = empty.Bans
+	}
+	if s.state.History == nil {
+		s.state.History = empty.History
+	}
+}
+
+func (s *FileStore) Append(rec Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return errors.New("store is closed")
+	}
+	if err := rec.check(); err != nil {
+		return err
+	}
+
+	// Write the record first, so the state never holds what the log lacks.
+	// A failed write is cut off, or the next record would follow a torn line.
+	end, err := s.log.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := s.log.Write(append(data, '\n')); err != nil {
+		s.log.Truncate(end)
+		s.log.Seek(end, io.SeekStart)
+		return err
+	}
+	return s.state.apply(rec)
+}
+
+func (s *FileStore) Load() (*GameState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.state.clone(), nil
+}
+
+// Compact writes the current state to state.json and empties the log.
+// The new state file is written aside and renamed into place, so a crash
+// leaves either the old state and log or the new state.
+func (s *FileStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return errors.New("store is closed")
+	}
+
+	data, err := json.Marshal(s.state)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(s.dir, stateFile+".tmp")
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(s.dir, stateFile)); err != nil {
+		return err
+	}
+	if err := s.log.Truncate(0); err != nil {
+		return err
+	}
+	_, err = s.log.Seek(0, io.SeekStart)
+	return err
+}
+
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.log == nil {
+		return nil
+	}
+	err := s.log.Close()
+	s.log = nil
+	return err
+}
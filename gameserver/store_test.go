@@ -0,0 +1,243 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileStoreReopen(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenFileStore(dir)
+	require.NoError(t, err)
+	until := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, rec := range []Record{
+		{Op: OpMap, Map: 1, MapOptions: &MapOptions{Capacity: 2}},
+		{Op: OpMap, Map: 2, MapOptions: &MapOptions{}},
+		{Op: OpPlayer, Player: "Alice", Map: 1},
+		{Op: OpBan, Player: "troll", Until: until},
+		{Op: OpMessage, Message: &Message{ID: 7, Sender: "Alice", Map: 1, Kind: KindChat, Body: "hi"}},
+		{Op: OpUnmap, Map: 2},
+	} {
+		require.NoError(t, s.Append(rec))
+	}
+	assert.Error(t, s.Append(Record{Op: "dance"}))
+	want, _ := s.Load()
+	require.NoError(t, s.Close())
+	assert.EqualError(t, s.Append(Record{Op: OpUnban, Player: "troll"}), "store is closed")
+
+	s, err = OpenFileStore(dir)
+	require.NoError(t, err)
+	got, _ := s.Load()
+	assert.Equal(t, want, got)
+	assert.Equal(t, map[int]MapOptions{1: {Capacity: 2}}, got.Maps)
+	assert.Equal(t, map[string]time.Time{"troll": until}, got.Bans)
+	assert.Equal(t, "hi", got.History[1][0].Body)
+
+	// After a compaction, the state comes from state.json and the log is empty.
+	require.NoError(t, s.Compact())
+	require.NoError(t, s.Append(Record{Op: OpUnban, Player: "troll"}))
+	require.NoError(t, s.Close())
+	s, err = OpenFileStore(dir)
+	require.NoError(t, err)
+	defer s.Close()
+	got, _ = s.Load()
+	assert.Empty(t, got.Bans)
+	assert.Equal(t, want.Players, got.Players)
+	log, _ := os.ReadFile(filepath.Join(dir, logFile))
+	assert.Equal(t, `{"op":"unban","player":"troll"}`+"\n", string(log))
+}
+
+func TestFileStoreTornLog(t *testing.T) {
+	dir := t.TempDir()
+	log := filepath.Join(dir, logFile)
+	require.NoError(t, os.WriteFile(log, []byte(`{"op":"player","player":"Alice","map":1}`+"\n"+`{"op":"pla`), 0o644))
+
+	// A crash in the middle of the last line loses that record only.
+	s, err := OpenFileStore(dir)
+	require.NoError(t, err)
+	require.NoError(t, s.Append(Record{Op: OpPlayer, Player: "Bob", Map: 2}))
+	require.NoError(t, s.Close())
+	s, err = OpenFileStore(dir)
+	require.NoError(t, err)
+	state, _ := s.Load()
+	s.Close()
+	assert.Equal(t, map[string]int{"Alice": 1, "Bob": 2}, state.Players)
+
+	// A broken record in the middle of the log is an error, not data loss.
+	require.NoError(t, os.WriteFile(log, []byte("oops\n"+`{"op":"player","player":"Alice","map":1}`+"\n"), 0o644))
+	_, err = OpenFileStore(dir)
+	assert.ErrorContains(t, err, "log.jsonl line 1")
+}
+
+func TestRestartFromStore(t *testing.T) {
+	for name, open := range map[string]func(t *testing.T) func() Store{
+		"memory": func(t *testing.T) func() Store {
+			s := NewMemoryStore()
+			return func() Store { return s }
+		},
+		"file": func(t *testing.T) func() Store {
+			dir := t.TempDir()
+			return func() Store {
+				s, err := OpenFileStore(dir)
+				require.NoError(t, err)
+				return s
+			}
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			reopen := open(t)
+
+			// 1) Run a first game.
+			store := reopen()
+			g, err := NewGameFromStore(store, []int{1, 2}, Options{})
+			require.NoError(t, err)
+			require.NoError(t, g.AddMap(3, MapOptions{Capacity: 5, Password: "pw"}))
+			require.NoError(t, g.RemoveMap(2, 0))
+			g.ConnectPlayer("Alice")
+			g.ConnectPlayer("Bob")
+			require.NoError(t, g.SwitchPlayerMapWithPassword("Alice", 3, "pw"))
+			require.NoError(t, g.Ban("", "Troll", 0))
+			alice, _ := g.GetPlayer("Alice")
+			require.NoError(t, alice.SendMessage("remember me"))
+			require.Eventually(t, func() bool {
+				msgs, _ := g.maps[3].History(0, 0)
+				return len(msgs) == 1
+			}, 2*time.Second, time.Millisecond)
+			require.NoError(t, g.Shutdown(context.Background()))
+			require.NoError(t, store.Close())
+			require.NoError(t, g.StoreError())
+
+			// 2) Restart: the maps, bans and history are back.
+			store = reopen()
+			defer store.Close()
+			g, err = NewGameFromStore(store, []int{1, 2}, Options{})
+			require.NoError(t, err)
+			assert.Equal(t, []int{1, 3}, sortedMapIds(g.maps))
+			assert.Equal(t, 5, g.maps[3].capacity)
+			assert.EqualError(t, g.ConnectPlayer("troll"), "player is banned")
+			msgs, _ := g.maps[3].History(0, 0)
+			require.Len(t, msgs, 1)
+			assert.Equal(t, "remember me", msgs[0].Body)
+
+			// Returning players go back to their map, without the password.
+			require.NoError(t, g.ConnectPlayer("alice"))
+			alice, _ = g.GetPlayer("Alice")
+			assert.Equal(t, 3, alice.zone)
+			assert.Equal(t, KindSystem, (<-alice.GetChannel()).Kind) // welcome
+			assert.Equal(t, "Alice says: remember me", (<-alice.GetChannel()).Text())
+			require.NoError(t, g.ConnectPlayer("Bob"))
+			bob, _ := g.GetPlayer("Bob")
+			assert.Equal(t, -1, bob.zone)
+
+			// New messages get IDs after the restored ones.
+			require.NoError(t, alice.SendMessage("again"))
+			require.Eventually(t, func() bool {
+				msgs, _ := g.maps[3].History(0, 0)
+				return len(msgs) == 2 && msgs[1].ID > msgs[0].ID
+			}, 2*time.Second, time.Millisecond)
+		})
+	}
+}
+
+func TestStorePlayerKey(t *testing.T) {
+	store := NewMemoryStore()
+	g, err := NewGameFromStore(store, []int{1, 2}, Options{})
+	require.NoError(t, err)
+
+	// The same player, whatever the case of its name, has a single last map.
+	g.ConnectPlayer("Alice")
+	require.NoError(t, g.SwitchPlayerMap("Alice", 1))
+	require.NoError(t, g.DisconnectPlayer("Alice"))
+	g.ConnectPlayer("ALICE")
+	require.NoError(t, g.SwitchPlayerMap("ALICE", 2))
+
+	state, err := store.Load()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]int{"alice": 2}, state.Players)
+}
+
+func TestFileStoreFailedWrite(t *testing.T) {
+	s, err := OpenFileStore(t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, s.Append(Record{Op: OpPlayer, Player: "alice", Map: 1}))
+
+	// A record the log could not take is not in the state either.
+	s.log.Close()
+	assert.Error(t, s.Append(Record{Op: OpPlayer, Player: "bob", Map: 1}))
+	state, _ := s.Load()
+	assert.Equal(t, map[string]int{"alice": 1}, state.Players)
+	s.log = nil
+}
+
+func TestRestartWithoutMaps(t *testing.T) {
+	store := NewMemoryStore()
+	g, err := NewGameFromStore(store, []int{1}, Options{})
+	require.NoError(t, err)
+	g.ConnectPlayer("Alice")
+	require.NoError(t, g.Ban("", "Troll", 0))
+	require.NoError(t, g.RemoveMap(1, 0))
+	require.NoError(t, g.Shutdown(context.Background()))
+
+	// The saved game has no maps, but it is not a new one: the bans stay
+	// and mapIds are not used.
+	g, err = NewGameFromStore(store, []int{1, 2}, Options{})
+	require.NoError(t, err)
+	assert.Empty(t, g.maps)
+	assert.EqualError(t, g.ConnectPlayer("troll"), "player is banned")
+}
+
+// slowStore is a MemoryStore whose Append waits while gate is locked, like a slow disk.
+type slowStore struct {
+	*MemoryStore
+	gate    sync.Mutex
+	entered chan struct{}
+}
+
+func (s *slowStore) Append(rec Record) error {
+	select {
+	case s.entered <- struct{}{}:
+	default:
+	}
+	s.gate.Lock()
+	s.gate.Unlock()
+	return s.MemoryStore.Append(rec)
+}
+
+func TestStoreWritesWithoutLocks(t *testing.T) {
+	store := &slowStore{MemoryStore: NewMemoryStore(), entered: make(chan struct{}, 1)}
+	g, err := NewGameFromStore(store, []int{1, 2}, Options{})
+	require.NoError(t, err)
+	require.NoError(t, g.ConnectPlayer("Alice"))
+
+	for _, change := range []func() error{
+		func() error { return g.SwitchPlayerMap("Alice", 1) },
+		func() error { return g.RemoveMap(2, 1) },
+		func() error { return g.Ban("", "Troll", 0) },
+	} {
+		select {
+		case <-store.entered:
+		default:
+		}
+		store.gate.Lock()
+		done := make(chan error)
+		go func() { done <- change() }()
+		<-store.entered
+
+		// The game and its maps stay usable while the store writes.
+		_, err := g.GetPlayer("Alice")
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"Alice"}, g.maps[1].PlayerNames())
+		store.gate.Unlock()
+		require.NoError(t, <-done)
+	}
+	state, _ := store.Load()
+	assert.Equal(t, map[string]int{"alice": 1}, state.Players)
+	assert.Equal(t, map[int]MapOptions{1: {}}, state.Maps)
+}
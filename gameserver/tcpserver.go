@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// TCPServer exposes a Game over TCP with a simple line protocol.
+// Every line is a command, and every command gets exactly one reply line.
+//
+// Client → server:
+//
+//	CONNECT <name>   connect as a new player (must be the first command)
+//	RESUME <token>   instead of CONNECT, get back the player of a lost connection
+//	JOIN <mapId>     move to another map; protected maps take a password: JOIN <mapId> <password>
+//	SAY <text>       send a chat message to everyone in the current map
+//	WHO              list the players in the current map
+//	QUIT             disconnect the player and close the connection
+//
+// Server → client:
+//
+//	OK               the command succeeded
+//	OK <token>       reply to CONNECT when sessions can be resumed (Options.ReconnectGrace)
+//	ERR <reason>     the command failed
+//	WHO <names...>   reply to WHO, names separated by spaces
+//	BYE              reply to QUIT, right before the connection is closed
+//	MSG <text>       a chat message from another player (sent at any time)
+//
+// The line protocol is chat only: snapshots from the tick loop are not sent.
+//
+// Commands are case-insensitive. On EOF the player is disconnected as if it sent QUIT,
+// or, with a reconnect grace window, left away until a new connection sends RESUME.
+// When the player is removed from the game (e.g. by Game.Shutdown) the connection is closed.
+type TCPServer struct {
+	g *Game
+
+	mu        sync.Mutex
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	closed    bool
+
+	// wg tracks every ServeConn call, whether started by Serve or by the caller.
+	wg sync.WaitGroup
+}
+
+// NewTCPServer creates a server for the given game. Call Serve or ServeConn to use it.
+func NewTCPServer(g *Game) *TCPServer {
+	return &TCPServer{
+		g:         g,
+		listeners: make(map[net.Listener]struct{}),
+		conns:     make(map[net.Conn]struct{}),
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and serves connections until Close is called.
+func (s *TCPServer) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	return s.Serve(ln)
+}
+
+// Serve accepts connections on ln and handles each one in its own goroutine.
+// It returns nil after Close, or the error that stopped the accept loop.
+func (s *TCPServer) Serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		ln.Close()
+		return errors.New("server is closed")
+	}
+	s.listeners[ln] = struct{}{}
+	s.mu.Unlock()
+
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closed := s.closed
+			delete(s.listeners, ln)
+			s.mu.Unlock()
+			if closed {
+				return nil
+			}
+			return err
+		}
+
+		go s.ServeConn(conn)
+	}
+}
+
+// ServeConn speaks the line protocol on a single connection and returns when
+// the client quits or the connection is closed. The connection is always closed on return.
+func (s *TCPServer) ServeConn(conn net.Conn) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		conn.Close()
+		return
+	}
+	s.conns[conn] = struct{}{}
+	s.wg.Add(1)
+	s.mu.Unlock()
+	defer s.wg.Done()
+
+	c := &tcpConn{conn: conn, done: make(chan struct{})}
+	quit := false
+	defer func() {
+		// Stop the writer and close the socket to unblock it if it is in the
+		// middle of a write, so that no one reads the player's messages anymore.
+		close(c.done)
+		conn.Close()
+		c.wg.Wait()
+
+		// Then free the player name, or keep the player away for RESUME if the
+		// connection was lost rather than closed with QUIT.
+		if c.p != nil {
+			if quit {
+				s.g.disconnect(c.p)
+			} else {
+				s.g.detach(c.p)
+			}
+		}
+
+		s.mu.Lock()
+		delete(s.conns, conn)
+		s.mu.Unlock()
+	}()
+
+	sc := bufio.NewScanner(conn)
+	for sc.Scan() {
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(sc.Text()), " ")
+		arg = strings.TrimSpace(arg)
+
+		switch strings.ToUpper(cmd) {
+		case "":
+			continue
+		case "CONNECT":
+			if err := s.connect(c, arg); err != nil {
+				c.reply(err)
+			} else if s.g.opts.ReconnectGrace > 0 {
+				c.write("OK " + c.p.SessionToken())
+			} else {
+				c.reply(nil)
+			}
+		case "RESUME":
+			c.reply(s.resume(c, arg))
+		case "JOIN":
+			c.reply(s.join(c, arg))
+		case "SAY":
+			if c.p == nil {
+				c.reply(errNotConnected)
+				continue
+			}
+			c.reply(c.p.SendMessage(arg))
+		case "WHO":
+			if c.p == nil {
+				c.reply(errNotConnected)
+				continue
+			}
+			c.write("WHO " + strings.Join(s.who(c.p), " "))
+		case "QUIT":
+			quit = true
+			c.write("BYE")
+			return
+		default:
+			c.reply(errors.New("unknown command: " + cmd))
+		}
+	}
+}
+
+// Close stops every listener, closes every connection and waits for their handlers to return.
+func (s *TCPServer) Close() error {
+	s.mu.Lock()
+	s.closed = true
+	for ln := range s.listeners {
+		ln.Close()
+	}
+	for conn := range s.conns {
+		conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return nil
+}
+
+var errNotConnected = errors.New("send CONNECT first")
+
+// connect handles CONNECT: it creates the player and starts streaming its messages.
+func (s *TCPServer) connect(c *tcpConn, name string) error {
+	if c.p != nil {
+		return errors.New("already connected")
+	}
+	if name == "" || strings.ContainsAny(name, " \t") {
+		return errors.New("invalid name")
+	}
+	p, err := s.g.connect(name)
+	if err != nil {
+		return err
+	}
+	s.attach(c, p)
+	return nil
+}
+
+// resume handles RESUME: it binds the connection to the player of a lost one.
+func (s *TCPServer) resume(c *tcpConn, token string) error {
+	if c.p != nil {
+		return errors.New("already connected")
+	}
+	p, err := s.g.Resume(token)
+	if err != nil {
+		return err
+	}
+	s.attach(c, p)
+	return nil
+}
+
+// attach binds the connection to p and starts streaming its messages,
+// including those that waited in its channel while it was away.
+func (s *TCPServer) attach(c *tcpConn, p *Player) {
+	c.p = p
+
+	// Forward everything the player receives to the socket until the connection ends.
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		for {
+			select {
+			case msg, ok := <-p.GetChannel():
+				if !ok {
+					// The player was disconnected by the game: end the session.
+					c.conn.Close()
+					return
+				}
+				if msg.Kind == KindSnapshot {
+					continue
+				}
+				c.write("MSG " + strings.ReplaceAll(msg.Text(), "\n", " "))
+			case <-c.done:
+				return
+			}
+		}
+	}()
+}
+
+// join handles JOIN.
+func (s *TCPServer) join(c *tcpConn, arg string) error {
+	if c.p == nil {
+		return errNotConnected
+	}
+	id, password, _ := strings.Cut(arg, " ")
+	mapId, err := strconv.Atoi(id)
+	if err != nil {
+		return errors.New("invalid map id")
+	}
+	return s.g.SwitchPlayerMapWithPassword(c.p.GetName(), mapId, strings.TrimSpace(password))
+}
+
+// who returns the names of the players in p's current map.
+func (s *TCPServer) who(p *Player) []string {
+	// p.m is written by SwitchPlayerMap under the game lock.
+	s.g.mu.Lock()
+	m := p.m
+	s.g.mu.Unlock()
+	if m == nil {
+		return nil
+	}
+	return m.PlayerNames()
+}
+
+// tcpConn is the state of one client connection.
+type tcpConn struct {
+	conn net.Conn
+	p    *Player // nil until CONNECT succeeds
+
+	// wmu serializes writes from the command loop and the message forwarder.
+	wmu  sync.Mutex
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func (c *tcpConn) write(line string) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.conn.Write([]byte(line + "\n"))
+}
+
+// reply writes OK for a nil error and ERR <reason> otherwise.
+func (c *tcpConn) reply(err error) {
+	if err != nil {
+		c.write("ERR " + err.Error())
+		return
+	}
+	c.write("OK")
+}
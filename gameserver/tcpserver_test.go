@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// tcpTestClient speaks the line protocol. MSG lines can arrive at any time,
+// so they are kept aside while waiting for a command reply.
+type tcpTestClient struct {
+	t    *testing.T
+	conn net.Conn
+	r    *bufio.Reader
+	msgs []string
+}
+
+// pipeClient starts a protocol session over net.Pipe and returns the client side.
+func pipeClient(t *testing.T, s *TCPServer) *tcpTestClient {
+	client, server := net.Pipe()
+	go s.ServeConn(server)
+	t.Cleanup(func() { client.Close() })
+	return &tcpTestClient{t: t, conn: client, r: bufio.NewReader(client)}
+}
+
+func (c *tcpTestClient) readLine() (string, error) {
+	c.conn.SetDeadline(time.Now().Add(2 * time.Second))
+	line, err := c.r.ReadString('\n')
+	return strings.TrimSuffix(line, "\n"), err
+}
+
+// send writes a command and returns its reply.
+func (c *tcpTestClient) send(line string) string {
+	c.conn.SetDeadline(time.Now().Add(2 * time.Second))
+	_, err := c.conn.Write([]byte(line + "\n"))
+	assert.NoError(c.t, err)
+	for {
+		reply, err := c.readLine()
+		if !assert.NoError(c.t, err) {
+			return ""
+		}
+		if !strings.HasPrefix(reply, "MSG ") {
+			return reply
+		}
+		c.msgs = append(c.msgs, reply)
+	}
+}
+
+// msg returns the next MSG line.
+func (c *tcpTestClient) msg() string {
+	if len(c.msgs) > 0 {
+		m := c.msgs[0]
+		c.msgs = c.msgs[1:]
+		return m
+	}
+	line, err := c.readLine()
+	assert.NoError(c.t, err)
+	return line
+}
+
+func TestTCPProtocol(t *testing.T) {
+	g, _ := NewGame([]int{1, 2})
+	s := NewTCPServer(g)
+
+	alice := pipeClient(t, s)
+	bob := pipeClient(t, s)
+
+	assert.Equal(t, "ERR send CONNECT first", alice.send("SAY hi"))
+	assert.Equal(t, "OK", alice.send("CONNECT Alice"))
+	assert.Equal(t, "OK", bob.send("connect Bob"))
+	assert.Equal(t, "ERR already connected", bob.send("CONNECT Carol"))
+	other := pipeClient(t, s)
+	assert.Equal(t, "ERR player already exists", other.send("CONNECT bob"))
+
+	assert.Equal(t, "OK", alice.send("JOIN 1"))
+	assert.Equal(t, "MSG Welcome to map 1! You are the first one here.", alice.msg())
+	assert.Equal(t, "OK", bob.send("JOIN 1"))
+	assert.Equal(t, "MSG Welcome to map 1! Players here: Alice", bob.msg())
+	assert.Equal(t, "MSG Bob joined", alice.msg())
+	assert.Equal(t, "ERR invalid map id", bob.send("JOIN one"))
+	assert.Equal(t, "WHO Alice Bob", bob.send("WHO"))
+
+	assert.Equal(t, "OK", alice.send("SAY hello there"))
+	assert.Equal(t, "MSG Alice says: hello there", bob.msg())
+
+	assert.Equal(t, "ERR unknown command: DANCE", bob.send("DANCE"))
+	assert.Equal(t, "BYE", bob.send("QUIT"))
+	_, err := bob.readLine()
+	assert.Error(t, err, "the server closes the connection after QUIT")
+	assert.Equal(t, "MSG Bob left", alice.msg())
+
+	// QUIT disconnected Bob, so the name can be used again.
+	again := pipeClient(t, s)
+	assert.Equal(t, "OK", again.send("CONNECT Bob"))
+}
+
+func TestTCPClosedByShutdown(t *testing.T) {
+	g, _ := NewGame([]int{1})
+	s := NewTCPServer(g)
+	c := pipeClient(t, s)
+	assert.Equal(t, "OK", c.send("CONNECT Cyn"))
+
+	assert.NoError(t, g.Shutdown(context.Background()))
+	_, err := c.readLine()
+	assert.Error(t, err, "the session ends when the game disconnects the player")
+}
+
+func TestTCPLoopback(t *testing.T) {
+	g, _ := NewGame([]int{1})
+	s := NewTCPServer(g)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+
+	served := make(chan error, 1)
+	go func() { served <- s.Serve(ln) }()
+
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	assert.NoError(t, err)
+	defer conn.Close()
+	c := &tcpTestClient{t: t, conn: conn, r: bufio.NewReader(conn)}
+	assert.Equal(t, "OK", c.send("CONNECT Cyn"))
+
+	assert.NoError(t, s.Close())
+	assert.NoError(t, <-served)
+	_, err = c.readLine()
+	assert.Error(t, err, "Close ends open connections")
+}
+
+func TestTCPCloseWaitsForServeConn(t *testing.T) {
+	g, _ := NewGame([]int{1})
+	s := NewTCPServer(g)
+	c := pipeClient(t, s)
+	assert.Equal(t, "OK", c.send("CONNECT Cyn"))
+
+	// ServeConn was called directly, not by Serve: Close still waits for it,
+	// so the player is gone by the time Close returns.
+	assert.NoError(t, s.Close())
+	_, err := g.GetPlayer("Cyn")
+	assert.Error(t, err)
+
+	// Connections handed over after Close are closed at once.
+	client, server := net.Pipe()
+	s.ServeConn(server)
+	_, err = client.Read(make([]byte, 1))
+	assert.Error(t, err)
+}
+
+func TestTCPConnectRenamed(t *testing.T) {
+	g, _ := NewGame([]int{1})
+	g.AddPlugin(renamePlugin{})
+	s := NewTCPServer(g)
+
+	// The connection is bound to the player the plugin created, not to "bob".
+	bob := pipeClient(t, s)
+	assert.Equal(t, "OK", bob.send("CONNECT bob"))
+	assert.Equal(t, "OK", bob.send("JOIN 1"))
+	assert.Equal(t, []string{"xbob"}, g.maps[1].PlayerNames())
+
+	// Closing the connection disconnects it: no ghost is left behind.
+	bob.conn.Close()
+	assert.Eventually(t, func() bool {
+		_, err := g.GetPlayer("xbob")
+		return err != nil
+	}, 2*time.Second, time.Millisecond)
+}
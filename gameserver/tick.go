@@ -0,0 +1,141 @@
+package main
+
+import (
+	"sort"
+	"time"
+)
+
+// maxQueuedInputs bounds the inputs waiting for the next tick of a map.
+const maxQueuedInputs = 1024
+
+// Snapshot is the world state of a map as seen by one player.
+// The first snapshot after entering a map is full; the next ones only hold
+// what changed since the previous snapshot the player got. No snapshot is
+// sent for a tick where nothing changed.
+type Snapshot struct {
+	Tick    uint64           `json:"tick"`
+	Full    bool             `json:"full,omitempty"`    // Players is the whole state, not a delta
+	Players map[string]Point `json:"players,omitempty"` // display name → position, for players who appeared or moved
+	Removed []string         `json:"removed,omitempty"` // players who left since the previous snapshot
+}
+
+// input is a move waiting for the next tick.
+type input struct {
+	p      *Player
+	dx, dy int
+}
+
+// QueueMove queues a move by (dx, dy), applied at the next tick of the player's
+// map. Moves are applied in the order they were queued; a move onto an obstacle
+// or out of the map is ignored. Unlike Move, it is meant for maps with a tick loop
+// (see Options.TickRate), where the tick decides the outcome.
+func (p *Player) QueueMove(dx, dy int) error {
+	g := p.g
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	m := p.m
+	if m == nil {
+		return ErrNotInMap
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.inputs) >= maxQueuedInputs {
+		return ErrInputQueueFull
+	}
+	m.inputs = append(m.inputs, input{p: p, dx: dx, dy: dy})
+	return nil
+}
+
+// Tick returns the number of ticks the map has run.
+func (m *Map) Tick() uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.tick
+}
+
+// tickLoop runs step at the game's tick rate until the map is closed.
+func (m *Map) tickLoop() {
+	ticker := m.g.opts.Clock.NewTicker(time.Second / time.Duration(m.g.opts.TickRate))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C():
+			m.step()
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+// step runs one game tick: it applies the queued inputs in order, then sends
+// every player in the map a snapshot of what changed.
+func (m *Map) step() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.tick++
+
+	// 1) Apply the inputs, skipping players who left the map since they queued them.
+	for _, in := range m.inputs {
+		if in.p.m != m {
+			continue
+		}
+		to := Point{in.p.pos.X + in.dx, in.p.pos.Y + in.dy}
+		if m.checkPosition(to) == nil {
+			m.grid.move(in.p, in.p.pos, to)
+			in.p.pos = to
+		}
+	}
+	m.inputs = m.inputs[:0]
+
+	// 2) Build the state once; it is shared, read-only, by every player's view.
+	state := make(map[string]Point, len(m.players))
+	for _, p := range m.players {
+		state[displayName(p.name)] = p.pos
+	}
+
+	// 3) Send each player the difference with the last state it got.
+	for _, p := range m.players {
+		snap := diffState(p.seen, state)
+		if snap == nil {
+			continue
+		}
+		snap.Tick = m.tick
+		msg := m.g.newMessage("", m.id, KindSnapshot, "")
+		msg.Snapshot = snap
+		if p.deliver(msg, false) {
+			p.seen = state
+		} else {
+			// The player missed a delta: start again from a full snapshot.
+			p.seen = nil
+		}
+	}
+}
+
+// diffState returns the snapshot turning seen into state: a full one if seen
+// is nil, or nil if nothing changed.
+func diffState(seen, state map[string]Point) *Snapshot {
+	if seen == nil {
+		return &Snapshot{Full: true, Players: state}
+	}
+
+	snap := &Snapshot{}
+	for name, pos := range state {
+		if old, ok := seen[name]; !ok || old != pos {
+			if snap.Players == nil {
+				snap.Players = make(map[string]Point)
+			}
+			snap.Players[name] = pos
+		}
+	}
+	for name := range seen {
+		if _, ok := state[name]; !ok {
+			snap.Removed = append(snap.Removed, name)
+		}
+	}
+	if snap.Players == nil && snap.Removed == nil {
+		return nil
+	}
+	sort.Strings(snap.Removed)
+	return snap
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffState(t *testing.T) {
+	state := map[string]Point{"Alice": {1, 1}, "Bob": {2, 2}}
+	assert.Equal(t, &Snapshot{Full: true, Players: state}, diffState(nil, state))
+	assert.Nil(t, diffState(state, state))
+
+	next := map[string]Point{"Alice": {1, 2}, "Cyn": {0, 0}}
+	assert.Equal(t, &Snapshot{
+		Players: map[string]Point{"Alice": {1, 2}, "Cyn": {0, 0}},
+		Removed: []string{"Bob"},
+	}, diffState(state, next))
+}
+
+func TestStepAppliesInputsInOrder(t *testing.T) {
+	g, _ := NewGame(nil)
+	require.NoError(t, g.AddMap(1, MapOptions{Width: 3, Height: 3, Obstacles: []Point{{2, 0}}}))
+	g.ConnectPlayer("Alice")
+	g.ConnectPlayer("Bob")
+	g.SwitchPlayerMap("Alice", 1)
+	alice, _ := g.GetPlayer("Alice")
+	m := g.maps[1]
+
+	m.step()
+	assert.Equal(t, &Snapshot{Tick: 1, Full: true, Players: map[string]Point{"Alice": {0, 0}}}, nextSnapshot(t, alice))
+
+	// Nothing changed: no snapshot for tick 2.
+	m.step()
+	assert.Equal(t, uint64(2), m.Tick())
+
+	// The second move is blocked by the obstacle, the third one applies from (1, 0).
+	require.NoError(t, alice.QueueMove(1, 0))
+	require.NoError(t, alice.QueueMove(1, 0))
+	require.NoError(t, alice.QueueMove(0, 2))
+	pos, _ := alice.Position()
+	assert.Equal(t, Point{0, 0}, pos, "moves wait for the tick")
+	g.SwitchPlayerMap("Bob", 1)
+	m.step()
+	assert.Equal(t, &Snapshot{Tick: 3, Players: map[string]Point{"Alice": {1, 2}, "Bob": {0, 0}}}, nextSnapshot(t, alice))
+	bob, _ := g.GetPlayer("Bob")
+	assert.Equal(t, &Snapshot{Tick: 3, Full: true, Players: map[string]Point{"Alice": {1, 2}, "Bob": {0, 0}}}, nextSnapshot(t, bob))
+
+	g.DisconnectPlayer("Bob")
+	m.step()
+	assert.Equal(t, &Snapshot{Tick: 4, Removed: []string{"Bob"}}, nextSnapshot(t, alice))
+
+	assert.EqualError(t, bob.QueueMove(1, 1), "player is not in a map")
+}
+
+func TestTickLoopWithManualClock(t *testing.T) {
+	g, clock := newTestGame(t, []int{1}, Options{TickRate: 10})
+	clock.waitTickers(t, 1)
+	g.ConnectPlayer("Alice")
+	g.SwitchPlayerMap("Alice", 1)
+	alice, _ := g.GetPlayer("Alice")
+
+	// Not a full tick period yet.
+	clock.advance(50 * time.Millisecond)
+	require.NoError(t, alice.QueueMove(2, 3))
+	clock.advance(50 * time.Millisecond)
+	snap := nextSnapshot(t, alice)
+	assert.Equal(t, uint64(1), snap.Tick)
+	assert.Equal(t, map[string]Point{"Alice": {2, 3}}, snap.Players)
+
+	// Three periods at once run three ticks.
+	require.NoError(t, alice.QueueMove(1, 0))
+	clock.advance(300 * time.Millisecond)
+	assert.Equal(t, &Snapshot{Tick: 2, Players: map[string]Point{"Alice": {3, 3}}}, nextSnapshot(t, alice))
+	assert.Eventually(t, func() bool { return g.maps[1].Tick() == 4 }, 2*time.Second, time.Millisecond)
+
+	// RemoveMap stops the tick loop.
+	require.NoError(t, g.RemoveMap(1, 0))
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// This file implements the server side of the WebSocket protocol (RFC 6455)
+// on top of net/http, so the gateway does not need any outside dependency.
+
+// wsGUID is the fixed GUID used to compute Sec-WebSocket-Accept (RFC 6455, section 1.3).
+const wsGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// WebSocket opcodes (RFC 6455, section 5.2).
+const (
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xA
+)
+
+// wsMaxMessage limits the size of a message a client can send.
+const wsMaxMessage = 64 * 1024
+
+var errWSClosed = errors.New("websocket closed")
+
+// wsConn is a server-side WebSocket connection.
+type wsConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+
+	// idle, when set, closes the connection if no frame (including a pong) arrives in time.
+	idle time.Duration
+
+	// wmu serializes frame writes; control frames may be sent while a message is written.
+	wmu sync.Mutex
+}
+
+// wsAccept computes the Sec-WebSocket-Accept header for a client key.
+func wsAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + wsGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// headerContains reports whether a comma-separated header has the given token (case-insensitive).
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wsUpgrade performs the opening handshake and takes over the HTTP connection.
+// On failure it writes an HTTP error response and returns an error.
+func wsUpgrade(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	// 1) Validate the client handshake (RFC 6455, section 4.2.1).
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return nil, errors.New("websocket: method is not GET")
+	}
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "websocket upgrade required", http.StatusBadRequest)
+		return nil, errors.New("websocket: not an upgrade request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("websocket: unsupported version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "invalid Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("websocket: invalid key")
+	}
+
+	// 2) Take over the underlying connection from net/http.
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "websocket not supported", http.StatusInternalServerError)
+		return nil, err
+	}
+
+	// 3) Send the server handshake.
+	resp := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + wsAccept(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(resp)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, r: rw.Reader}, nil
+}
+
+// ReadMessage returns the next text or binary message, reassembling fragments.
+// Pings are answered automatically and pongs are skipped. It returns errWSClosed
+// after the client sent a close frame (which is answered before returning).
+func (c *wsConn) ReadMessage() (opcode byte, payload []byte, err error) {
+	var msg []byte
+	msgOpcode := byte(0)
+	for {
+		fin, op, data, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch op {
+		case wsPing:
+			if err := c.WriteFrame(wsPong, data); err != nil {
+				return 0, nil, err
+			}
+		case wsPong:
+			// Keepalive answer; reading it already refreshed the idle deadline.
+		case wsClose:
+			c.WriteFrame(wsClose, closePayload(data))
+			return 0, nil, errWSClosed
+		case wsText, wsBinary:
+			if msgOpcode != 0 {
+				return 0, nil, errors.New("websocket: new message inside a fragmented message")
+			}
+			msgOpcode, msg = op, data
+		case wsContinuation:
+			if msgOpcode == 0 {
+				return 0, nil, errors.New("websocket: unexpected continuation frame")
+			}
+			msg = append(msg, data...)
+		default:
+			return 0, nil, errors.New("websocket: unknown opcode")
+		}
+
+		if len(msg) > wsMaxMessage {
+			return 0, nil, errors.New("websocket: message too large")
+		}
+		if fin && msgOpcode != 0 && op != wsPing && op != wsPong {
+			return msgOpcode, msg, nil
+		}
+	}
+}
+
+// readFrame reads a single frame (RFC 6455, section 5.2). Client frames must be masked.
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	if c.idle > 0 {
+		c.conn.SetReadDeadline(time.Now().Add(c.idle))
+	}
+
+	var head [2]byte
+	if _, err := io.ReadFull(c.r, head[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = head[0]&0x80 != 0
+	opcode = head[0] & 0x0F
+	if head[0]&0x70 != 0 {
+		return false, 0, nil, errors.New("websocket: reserved bits are set")
+	}
+	if head[1]&0x80 == 0 {
+		return false, 0, nil, errors.New("websocket: client frame is not masked")
+	}
+
+	length := uint64(head[1] & 0x7F)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if opcode >= wsClose && (length > 125 || !fin) {
+		return false, 0, nil, errors.New("websocket: invalid control frame")
+	}
+	if length > wsMaxMessage {
+		return false, 0, nil, errors.New("websocket: frame too large")
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(c.r, mask[:]); err != nil {
+		return false, 0, nil, err
+	}
+	payload = make([]byte, length)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// WriteFrame sends a single unfragmented, unmasked frame. With an idle
+// timeout set, a client that stops reading fails the write after that long.
+func (c *wsConn) WriteFrame(opcode byte, payload []byte) error {
+	var deadline time.Time
+	if c.idle > 0 {
+		deadline = time.Now().Add(c.idle)
+	}
+	return c.writeFrame(opcode, payload, deadline)
+}
+
+// writeFrame is WriteFrame with a write deadline; a zero deadline means none.
+func (c *wsConn) writeFrame(opcode byte, payload []byte, deadline time.Time) error {
+	frame := make([]byte, 0, len(payload)+10)
+	frame = append(frame, 0x80|opcode)
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	frame = append(frame, payload...)
+
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.conn.SetWriteDeadline(deadline)
+	_, err := c.conn.Write(frame)
+	return err
+}
+
+// Close sends a close frame with the given status code and closes the connection.
+func (c *wsConn) Close(code uint16) error {
+	// Do not let a client that stopped reading block the close.
+	c.writeFrame(wsClose, binary.BigEndian.AppendUint16(nil, code), time.Now().Add(time.Second))
+	return c.conn.Close()
+}
+
+// closePayload echoes the status code of a client close frame.
+func closePayload(data []byte) []byte {
+	if len(data) >= 2 {
+		return data[:2]
+	}
+	return nil
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// WSEvent is a JSON event pushed to WebSocket clients.
+//
+//	{"type":"message","kind":"chat","player":"Alice","map":1,"id":7,"text":"Alice says: hi"}
+//	{"type":"join","player":"Alice","map":1,...}     a player entered the client's map
+//	{"type":"leave","player":"Alice","map":1,...}    a player left the client's map
+//	{"type":"error","text":"map not found"}      a client command failed
+//	{"type":"session","token":"9f86d08…"}        first event, when sessions can be resumed
+//	{"type":"snapshot","map":1,"state":{"tick":3,"players":{"Alice":{"x":1,"y":2}}}}
+//	                                             world state from the tick loop (see Snapshot)
+//
+// Events are built from the Messages of the player: join and leave notices
+// become "join" and "leave" events, everything else (chat, emotes, system
+// notices like the welcome message) becomes a "message" event whose kind is
+// the Message kind and whose text is Message.Text.
+type WSEvent struct {
+	Type   string      `json:"type"`
+	Kind   MessageKind `json:"kind,omitempty"`
+	Player string      `json:"player,omitempty"`
+	Map    int         `json:"map,omitempty"`
+	ID     uint64      `json:"id,omitempty"`
+	Text   string      `json:"text,omitempty"`
+	State  *Snapshot   `json:"state,omitempty"`
+	Token  string      `json:"token,omitempty"`
+}
+
+// wsCommand is a JSON command sent by a WebSocket client.
+//
+//	{"type":"join","map":1}
+//	{"type":"join","map":2,"password":"secret"}
+//	{"type":"say","text":"hi"}
+//	{"type":"move","dx":1,"dy":0}
+type wsCommand struct {
+	Type     string `json:"type"`
+	Map      int    `json:"map"`
+	Password string `json:"password"`
+	Text     string `json:"text"`
+	DX       int    `json:"dx"`
+	DY       int    `json:"dy"`
+}
+
+// WSGateway serves a Game to browsers over WebSocket.
+// A client connects to /ws?name=<player>; the socket is bound to that player
+// until it is closed, and closing it disconnects the player. With a reconnect
+// grace window (Options.ReconnectGrace), a socket that breaks without a close
+// handshake leaves the player away instead, and a new socket to
+// /ws?token=<token> resumes the session.
+type WSGateway struct {
+	g *Game
+
+	// PingInterval is how often the server pings every client.
+	PingInterval time.Duration
+	// IdleTimeout closes a socket when nothing (not even a pong) was received for that long.
+	IdleTimeout time.Duration
+
+	mu      sync.Mutex
+	clients map[*wsClient]struct{}
+	closed  bool
+
+	// wg tracks every socket handler; Add is called under mu, so that it
+	// cannot race with the Wait in Close.
+	wg sync.WaitGroup
+}
+
+// wsClient is one WebSocket connection bound to a player.
+type wsClient struct {
+	ws   *wsConn
+	p    *Player
+	send chan WSEvent // events waiting to be written by the writer goroutine
+	done chan struct{}
+}
+
+// NewWSGateway creates a gateway for the given game with a 20s ping interval
+// and a 60s idle timeout.
+func NewWSGateway(g *Game) *WSGateway {
+	return &WSGateway{
+		g:            g,
+		PingInterval: 20 * time.Second,
+		IdleTimeout:  60 * time.Second,
+		clients:      make(map[*wsClient]struct{}),
+	}
+}
+
+// Handler returns an HTTP handler exposing the WebSocket endpoint at /ws.
+func (gw *WSGateway) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", gw.serveWS)
+	return mux
+}
+
+// ListenAndServe serves the gateway on the TCP address addr.
+func (gw *WSGateway) ListenAndServe(addr string) error {
+	return http.ListenAndServe(addr, gw.Handler())
+}
+
+// Close closes every open socket and waits for their handlers to return.
+// Sockets opened after Close are closed at once.
+func (gw *WSGateway) Close() error {
+	gw.mu.Lock()
+	gw.closed = true
+	for c := range gw.clients {
+		c.ws.conn.Close()
+	}
+	gw.mu.Unlock()
+
+	gw.wg.Wait()
+	return nil
+}
+
+func (gw *WSGateway) serveWS(w http.ResponseWriter, r *http.Request) {
+	name, token := r.URL.Query().Get("name"), r.URL.Query().Get("token")
+	if name == "" && token == "" {
+		http.Error(w, "missing name", http.StatusBadRequest)
+		return
+	}
+
+	ws, err := wsUpgrade(w, r)
+	if err != nil {
+		return // wsUpgrade already answered the request
+	}
+	ws.idle = gw.IdleTimeout
+
+	gw.mu.Lock()
+	if gw.closed {
+		gw.mu.Unlock()
+		ws.Close(1001) // going away
+		return
+	}
+	gw.wg.Add(1)
+	gw.mu.Unlock()
+	defer gw.wg.Done()
+
+	// 1) Bind the socket to a new player, or to the player of a lost socket.
+	p, err := gw.bind(name, token)
+	if err != nil {
+		writeEvent(ws, WSEvent{Type: "error", Text: err.Error()})
+		ws.Close(1008) // policy violation
+		return
+	}
+	if token == "" && gw.g.opts.ReconnectGrace > 0 {
+		if err := writeEvent(ws, WSEvent{Type: "session", Token: p.SessionToken()}); err != nil {
+			gw.g.detach(p)
+			ws.conn.Close()
+			return
+		}
+	}
+
+	c := &wsClient{
+		ws:   ws,
+		p:    p,
+		send: make(chan WSEvent, 100),
+		done: make(chan struct{}),
+	}
+	gw.mu.Lock()
+	gw.clients[c] = struct{}{}
+	if gw.closed {
+		// Close ran while the player was bound: it did not see this socket.
+		ws.conn.Close()
+	}
+	gw.mu.Unlock()
+
+	// 2) Start the writer: it owns every write except control frames.
+	var writer sync.WaitGroup
+	writer.Add(1)
+	go func() {
+		defer writer.Done()
+		gw.writeLoop(c)
+	}()
+
+	// 3) Read commands until the socket is closed or idle for too long.
+	code := uint16(1000) // normal closure
+	for {
+		_, data, err := ws.ReadMessage()
+		if err != nil {
+			if errors.Is(err, errWSClosed) {
+				code = 0 // the close handshake is already done
+			} else {
+				code = 1001 // going away: idle timeout or broken connection
+			}
+			break
+		}
+		gw.handle(c, data)
+	}
+
+	// 4) Clean up: stop the writer, close the socket and disconnect the player
+	// (which tells its map that it left). A socket that broke without a close
+	// handshake only leaves the player away, in case the client comes back.
+	// The writer may be stuck on a client that stopped reading: a past
+	// deadline fails its write at once (ws.Close sets a new one for the close
+	// frame), like ServeConn closes its conn before waiting for its writer.
+	close(c.done)
+	ws.conn.SetWriteDeadline(time.Now())
+	writer.Wait()
+	if code != 0 {
+		ws.Close(code)
+		gw.g.detach(p)
+	} else {
+		ws.conn.Close()
+		gw.g.disconnect(p)
+	}
+
+	gw.mu.Lock()
+	delete(gw.clients, c)
+	gw.mu.Unlock()
+}
+
+// bind returns the player a new socket is for: a new player called name, or
+// the player of the session token.
+func (gw *WSGateway) bind(name, token string) (*Player, error) {
+	if token != "" {
+		return gw.g.Resume(token)
+	}
+	return gw.g.connect(name)
+}
+
+// handle runs a single client command.
+func (gw *WSGateway) handle(c *wsClient, data []byte) {
+	var cmd wsCommand
+	if err := json.Unmarshal(data, &cmd); err != nil {
+		c.push(WSEvent{Type: "error", Text: "invalid command"})
+		return
+	}
+
+	switch cmd.Type {
+	case "join":
+		if err := gw.g.SwitchPlayerMapWithPassword(c.p.GetName(), cmd.Map, cmd.Password); err != nil {
+			c.push(WSEvent{Type: "error", Text: err.Error()})
+		}
+	case "say":
+		if err := c.p.SendMessage(cmd.Text); err != nil {
+			c.push(WSEvent{Type: "error", Text: err.Error()})
+		}
+	case "move":
+		// With a tick loop, the move is applied at the next tick and shows in the next snapshot.
+		move := c.p.Move
+		if gw.g.opts.TickRate > 0 {
+			move = c.p.QueueMove
+		}
+		if err := move(cmd.DX, cmd.DY); err != nil {
+			c.push(WSEvent{Type: "error", Text: err.Error()})
+		}
+	default:
+		c.push(WSEvent{Type: "error", Text: "unknown command: " + cmd.Type})
+	}
+}
+
+// writeLoop writes queued events, chat messages and keepalive pings until the client is done.
+func (gw *WSGateway) writeLoop(c *wsClient) {
+	ping := time.NewTicker(gw.PingInterval)
+	defer ping.Stop()
+
+	for {
+		var err error
+		select {
+		case e := <-c.send:
+			err = writeEvent(c.ws, e)
+		case msg, ok := <-c.p.GetChannel():
+			if !ok {
+				// The player was disconnected by the game: end the session.
+				c.ws.Close(1001)
+				return
+			}
+			err = writeEvent(c.ws, messageEvent(msg))
+		case <-ping.C:
+			err = c.ws.WriteFrame(wsPing, nil)
+		case <-c.done:
+			return
+		}
+		if err != nil {
+			// The socket is broken; closing it makes the read loop return too.
+			c.ws.conn.Close()
+			return
+		}
+	}
+}
+
+// push queues an event without blocking; like FanOutMessages, it drops the
+// event when the client is too slow.
+func (c *wsClient) push(e WSEvent) {
+	select {
+	case c.send <- e:
+	default:
+	}
+}
+
+// messageEvent converts a player Message into the event sent to the browser.
+func messageEvent(msg Message) WSEvent {
+	e := WSEvent{
+		Type:   "message",
+		Kind:   msg.Kind,
+		Player: msg.Sender,
+		Map:    msg.Map,
+		ID:     msg.ID,
+		Text:   msg.Text(),
+	}
+	switch msg.Kind {
+	case KindJoin:
+		e.Type = "join"
+	case KindLeave:
+		e.Type = "leave"
+	case KindSnapshot:
+		e.Type = "snapshot"
+		e.State = msg.Snapshot
+	}
+	return e
+}
+
+func writeEvent(ws *wsConn, e WSEvent) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	return ws.WriteFrame(wsText, data)
+}
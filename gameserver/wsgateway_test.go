@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// wsTestClient is a minimal WebSocket client used to drive the gateway in tests.
+type wsTestClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func dialWS(t *testing.T, srv *httptest.Server, name string) *wsTestClient {
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	key := make([]byte, 16)
+	rand.Read(key)
+	encodedKey := base64.StdEncoding.EncodeToString(key)
+	req := "GET /ws?name=" + name + " HTTP/1.1\r\n" +
+		"Host: " + srv.Listener.Addr().String() + "\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + encodedKey + "\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"
+	_, err = conn.Write([]byte(req))
+	require.NoError(t, err)
+
+	r := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(r, nil)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+	require.Equal(t, wsAccept(encodedKey), resp.Header.Get("Sec-WebSocket-Accept"))
+	return &wsTestClient{conn: conn, r: r}
+}
+
+// writeFrame sends a masked frame, as clients must.
+func (c *wsTestClient) writeFrame(t *testing.T, opcode byte, payload []byte) {
+	frame := []byte{0x80 | opcode}
+	if len(payload) < 126 {
+		frame = append(frame, 0x80|byte(len(payload)))
+	} else {
+		frame = append(frame, 0x80|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(len(payload)))
+	}
+	mask := []byte{1, 2, 3, 4}
+	frame = append(frame, mask...)
+	for i, b := range payload {
+		frame = append(frame, b^mask[i%4])
+	}
+	_, err := c.conn.Write(frame)
+	require.NoError(t, err)
+}
+
+func (c *wsTestClient) command(t *testing.T, cmd string) {
+	c.writeFrame(t, wsText, []byte(cmd))
+}
+
+func (c *wsTestClient) readFrame(t *testing.T) (byte, []byte) {
+	c.conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	var head [2]byte
+	_, err := io.ReadFull(c.r, head[:])
+	require.NoError(t, err)
+	length := int(head[1] & 0x7F)
+	if length == 126 {
+		var ext [2]byte
+		io.ReadFull(c.r, ext[:])
+		length = int(binary.BigEndian.Uint16(ext[:]))
+	}
+	payload := make([]byte, length)
+	_, err = io.ReadFull(c.r, payload)
+	require.NoError(t, err)
+	return head[0] & 0x0F, payload
+}
+
+// readEvent skips keepalive pings and returns the next JSON event.
+// Message IDs are checked and then cleared, so events can be compared as values.
+func (c *wsTestClient) readEvent(t *testing.T) WSEvent {
+	for {
+		op, payload := c.readFrame(t)
+		if op == wsPing {
+			continue
+		}
+		require.Equal(t, byte(wsText), op, string(payload))
+		var e WSEvent
+		require.NoError(t, json.Unmarshal(payload, &e))
+		if e.Type != "error" {
+			assert.NotZero(t, e.ID)
+		}
+		e.ID = 0
+		return e
+	}
+}
+
+func TestWSGatewayChat(t *testing.T) {
+	g, _ := NewGame([]int{1, 2})
+	gw := NewWSGateway(g)
+	srv := httptest.NewServer(gw.Handler())
+	defer srv.Close()
+	defer gw.Close()
+
+	alice := dialWS(t, srv, "Alice")
+	bob := dialWS(t, srv, "Bob")
+
+	alice.command(t, `{"type":"join","map":1}`)
+	assert.Equal(t, WSEvent{Type: "message", Kind: KindSystem, Map: 1, Text: "Welcome to map 1! You are the first one here."}, alice.readEvent(t))
+	bob.command(t, `{"type":"join","map":1}`)
+	assert.Equal(t, WSEvent{Type: "join", Kind: KindJoin, Player: "Bob", Map: 1, Text: "Bob joined"}, alice.readEvent(t))
+	assert.Equal(t, WSEvent{Type: "message", Kind: KindSystem, Map: 1, Text: "Welcome to map 1! Players here: Alice"}, bob.readEvent(t))
+
+	alice.command(t, `{"type":"say","text":"hi bob"}`)
+	assert.Equal(t, WSEvent{Type: "message", Kind: KindChat, Player: "Alice", Map: 1, Text: "Alice says: hi bob"}, bob.readEvent(t))
+
+	bob.command(t, `{"type":"join","map":2}`)
+	assert.Equal(t, WSEvent{Type: "leave", Kind: KindLeave, Player: "Bob", Map: 1, Text: "Bob left"}, alice.readEvent(t))
+	assert.Equal(t, KindSystem, bob.readEvent(t).Kind)
+
+	bob.command(t, `{"type":"join","map":9}`)
+	assert.Equal(t, WSEvent{Type: "error", Text: "map not found"}, bob.readEvent(t))
+
+	// A long message uses the 16-bit length encoding.
+	long := strings.Repeat("x", 300)
+	bob.command(t, `{"type":"join","map":1}`)
+	bob.readEvent(t)
+	alice.readEvent(t)
+	bob.command(t, `{"type":"say","text":"`+long+`"}`)
+	assert.Equal(t, "Bob says: "+long, alice.readEvent(t).Text)
+}
+
+func TestWSGatewayRejectsDuplicateName(t *testing.T) {
+	g, _ := NewGame([]int{1})
+	gw := NewWSGateway(g)
+	srv := httptest.NewServer(gw.Handler())
+	defer srv.Close()
+	defer gw.Close()
+
+	dialWS(t, srv, "Cyn")
+	other := dialWS(t, srv, "cyn")
+	assert.Equal(t, WSEvent{Type: "error", Text: "player already exists"}, other.readEvent(t))
+	op, _ := other.readFrame(t)
+	assert.Equal(t, byte(wsClose), op)
+
+	resp, err := http.Get(srv.URL + "/ws?name=Plain")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestWSGatewayKeepalive(t *testing.T) {
+	g, _ := NewGame([]int{1})
+	gw := NewWSGateway(g)
+	gw.PingInterval = 20 * time.Millisecond
+	gw.IdleTimeout = 150 * time.Millisecond
+	srv := httptest.NewServer(gw.Handler())
+	defer srv.Close()
+	defer gw.Close()
+
+	// A client that answers pings stays connected past the idle timeout.
+	c := dialWS(t, srv, "Alice")
+	deadline := time.Now().Add(300 * time.Millisecond)
+	for time.Now().Before(deadline) {
+		op, payload := c.readFrame(t)
+		require.Equal(t, byte(wsPing), op)
+		c.writeFrame(t, wsPong, payload)
+	}
+	c.command(t, `{"type":"join","map":1}`)
+	assert.Equal(t, KindSystem, c.readEvent(t).Kind)
+
+	// A client that stops answering is closed.
+	for {
+		op, _ := c.readFrame(t)
+		if op == wsClose {
+			break
+		}
+		require.Equal(t, byte(wsPing), op)
+	}
+}
+
+func TestWSGatewayClientNotReading(t *testing.T) {
+	g, _ := NewGame([]int{1})
+	gw := NewWSGateway(g)
+	gw.IdleTimeout = 200 * time.Millisecond
+	srv := httptest.NewServer(gw.Handler())
+	defer srv.Close()
+
+	// The client joins, then neither reads nor writes: the writer fills the
+	// socket buffers and blocks until its write deadline.
+	c := dialWS(t, srv, "Stuck")
+	c.command(t, `{"type":"join","map":1}`)
+	require.Eventually(t, func() bool { return len(g.maps[1].PlayerNames()) == 1 }, 2*time.Second, time.Millisecond)
+	big := strings.Repeat("x", 64<<10)
+	for i := 0; i < 200; i++ {
+		g.Broadcast(big)
+	}
+
+	// The idle socket is closed, the player removed and the handler ends.
+	assert.Eventually(t, func() bool {
+		_, err := g.GetPlayer("Stuck")
+		return err != nil
+	}, 2*time.Second, 10*time.Millisecond)
+	done := make(chan struct{})
+	go func() {
+		gw.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Close is stuck on the handler")
+	}
+}
+
+func TestWSGatewayClosed(t *testing.T) {
+	g, _ := NewGame([]int{1})
+	gw := NewWSGateway(g)
+	srv := httptest.NewServer(gw.Handler())
+	defer srv.Close()
+	require.NoError(t, gw.Close())
+
+	// A socket opened after Close is closed at once, without a player.
+	c := dialWS(t, srv, "Late")
+	op, _ := c.readFrame(t)
+	assert.Equal(t, byte(wsClose), op)
+	_, err := g.GetPlayer("Late")
+	assert.ErrorIs(t, err, ErrPlayerNotFound)
+}
@@ -0,0 +1,89 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"vc/workdir"
+)
+
+// ArchiveFormat selects the file format written by Archive.
+type ArchiveFormat string
+
+const (
+	ArchiveTar ArchiveFormat = "tar"
+	ArchiveZip ArchiveFormat = "zip"
+)
+
+// Archive writes the snapshot recorded in the given revision to w.
+// When prefix is not empty, every path in the archive is placed under it
+// (e.g., prefix "project-1.0" turns "src/main.go" into "project-1.0/src/main.go").
+func (v *VC) Archive(rev string, format ArchiveFormat, w io.Writer, prefix string) error {
+	c, err := v.resolve(rev)
+	if err != nil {
+		return err
+	}
+
+	tree := c.tree
+	if prefix = strings.Trim(path.Clean("/"+prefix), "/"); prefix != "" {
+		if tree, err = withPrefix(c.tree, prefix); err != nil {
+			return err
+		}
+	}
+
+	switch format {
+	case ArchiveTar:
+		return tree.ExportTar(w)
+	case ArchiveZip:
+		return tree.ExportZip(w)
+	default:
+		return fmt.Errorf("unknown archive format: %s", format)
+	}
+}
+
+// withPrefix returns a copy of tree with every directory and file moved under prefix.
+func withPrefix(tree *workdir.WorkDir, prefix string) (*workdir.WorkDir, error) {
+	res := workdir.InitEmptyWorkDir()
+	if err := graft(res, prefix, tree); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// graft copies every directory and file of src into dst under prefix,
+// keeping their modes and modification times.
+func graft(dst *workdir.WorkDir, prefix string, src *workdir.WorkDir) error {
+	ensureDir(dst, prefix)
+
+	for _, d := range src.ListDirs() {
+		ensureDir(dst, prefix+"/"+d)
+		if err := copyAttrs(src, d, dst, prefix+"/"+d); err != nil {
+			return err
+		}
+	}
+	for _, f := range src.ListFilesRoot() {
+		content, _ := src.CatFile(f)
+		if err := dst.CreateFile(prefix + "/" + f); err != nil {
+			return err
+		}
+		dst.WriteToFile(prefix+"/"+f, content)
+		if err := copyAttrs(src, f, dst, prefix+"/"+f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyAttrs copies the mode and modification time of one entry to another WorkDir.
+func copyAttrs(from *workdir.WorkDir, fromPath string, to *workdir.WorkDir, toPath string) error {
+	info, err := from.Stat(fromPath)
+	if err != nil {
+		return err
+	}
+	if err := to.Chmod(toPath, info.Mode); err != nil {
+		return err
+	}
+	return to.Chtimes(toPath, info.ModTime)
+}
@@ -0,0 +1,193 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"vc/workdir"
+)
+
+// BisectResult is the outcome of testing one commit during a bisection.
+type BisectResult int
+
+const (
+	BisectGood BisectResult = iota // the commit does not have the regression
+	BisectBad                      // the commit has the regression
+	BisectSkip                     // the commit cannot be tested
+)
+
+func (r BisectResult) String() string {
+	switch r {
+	case BisectGood:
+		return "good"
+	case BisectBad:
+		return "bad"
+	case BisectSkip:
+		return "skip"
+	default:
+		return fmt.Sprintf("BisectResult(%d)", int(r))
+	}
+}
+
+// BisectStep is one decision of the bisection log.
+type BisectStep struct {
+	Commit string
+	Result BisectResult
+}
+
+// BisectSession is a bisection driven step by step: test the WorkDir returned
+// by Current, report the outcome with Mark, and repeat until Done.
+type BisectSession struct {
+	v *VC
+
+	// commits are the candidates from the oldest to the newest; the last one is the known bad commit.
+	commits []*commit
+	// lo is the index of the newest commit known to be good (-1 is the good revision itself),
+	// hi is the index of the oldest commit known to be bad.
+	lo, hi  int
+	skipped map[int]bool
+	current int // index of the commit to test next, -1 when the session is done
+	log     []BisectStep
+}
+
+// Bisect binary-searches the commits after good up to bad for the first one
+// that test reports as bad. It returns that commit's ID and the decision log.
+// If skipped commits make the answer ambiguous, an error lists the possible commits.
+func (v *VC) Bisect(good, bad string, test func(*workdir.WorkDir) (BisectResult, error)) (string, []BisectStep, error) {
+	s, err := v.StartBisect(good, bad)
+	if err != nil {
+		return "", nil, err
+	}
+
+	for !s.Done() {
+		_, wd, err := s.Current()
+		if err != nil {
+			return "", s.Log(), err
+		}
+		result, err := test(wd)
+		if err != nil {
+			return "", s.Log(), fmt.Errorf("bisect test failed: %w", err)
+		}
+		if err := s.Mark(result); err != nil {
+			return "", s.Log(), err
+		}
+	}
+
+	first, err := s.FirstBad()
+	return first, s.Log(), err
+}
+
+// StartBisect starts a manual bisection between a good and a bad revision.
+// The good revision must be an ancestor of the bad one.
+func (v *VC) StartBisect(good, bad string) (*BisectSession, error) {
+	g, err := v.resolve(good)
+	if err != nil {
+		return nil, err
+	}
+	b, err := v.resolve(bad)
+	if err != nil {
+		return nil, err
+	}
+
+	// Walk back from the bad commit to the good one, then reverse the list.
+	commits := make([]*commit, 0)
+	for c := b; c != g; c = v.commits[c.parent] {
+		if c == nil {
+			return nil, fmt.Errorf("%s is not an ancestor of %s", good, bad)
+		}
+		commits = append(commits, c)
+	}
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("good and bad revisions are the same commit")
+	}
+	for i, j := 0, len(commits)-1; i < j; i, j = i+1, j-1 {
+		commits[i], commits[j] = commits[j], commits[i]
+	}
+
+	s := &BisectSession{
+		v:       v,
+		commits: commits,
+		lo:      -1,
+		hi:      len(commits) - 1,
+		skipped: make(map[int]bool),
+		log:     make([]BisectStep, 0),
+	}
+	s.pick()
+	return s, nil
+}
+
+// Current returns the commit to test next and a fresh copy of its WorkDir.
+func (s *BisectSession) Current() (string, *workdir.WorkDir, error) {
+	if s.Done() {
+		return "", nil, fmt.Errorf("bisection is already done")
+	}
+	c := s.commits[s.current]
+	wd, err := s.v.CheckoutRecursive(c.id)
+	if err != nil {
+		return "", nil, err
+	}
+	return c.id, wd, nil
+}
+
+// Mark records the outcome of testing the current commit and picks the next one.
+func (s *BisectSession) Mark(result BisectResult) error {
+	if s.Done() {
+		return fmt.Errorf("bisection is already done")
+	}
+
+	switch result {
+	case BisectGood:
+		s.lo = s.current
+	case BisectBad:
+		s.hi = s.current
+	case BisectSkip:
+		s.skipped[s.current] = true
+	default:
+		return fmt.Errorf("invalid bisect result: %d", result)
+	}
+	s.log = append(s.log, BisectStep{Commit: s.commits[s.current].id, Result: result})
+	s.pick()
+	return nil
+}
+
+// Done reports whether there is nothing left to test.
+func (s *BisectSession) Done() bool {
+	return s.current < 0
+}
+
+// FirstBad returns the first bad commit once the session is done.
+// When skipped commits hide the answer, the error lists every commit that may be the first bad one.
+func (s *BisectSession) FirstBad() (string, error) {
+	if !s.Done() {
+		return "", fmt.Errorf("bisection is not done yet")
+	}
+	if s.hi-s.lo == 1 {
+		return s.commits[s.hi].id, nil
+	}
+
+	ids := make([]string, 0, s.hi-s.lo)
+	for i := s.lo + 1; i <= s.hi; i++ {
+		ids = append(ids, s.commits[i].id)
+	}
+	return "", fmt.Errorf("could not find the first bad commit because of skipped commits, it is one of: %s",
+		strings.Join(ids, ", "))
+}
+
+// Log returns a copy of every decision made so far.
+func (s *BisectSession) Log() []BisectStep {
+	return append([]BisectStep(nil), s.log...)
+}
+
+// pick chooses the untested commit nearest to the middle of the unknown range.
+func (s *BisectSession) pick() {
+	s.current = -1
+	mid := (s.lo + s.hi + 1) / 2
+	for d := 0; d < s.hi-s.lo; d++ {
+		for _, i := range []int{mid - d, mid + d} {
+			if i > s.lo && i < s.hi && !s.skipped[i] {
+				s.current = i
+				return
+			}
+		}
+	}
+}
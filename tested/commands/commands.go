@@ -1,6 +1,19 @@
 package commands
 
-import "vc/workdir"
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"vc/workdir"
+)
 
 // VC (Version Control) represents a simplified version control system,
 // similar to Git. It keeps track of a working directory and provides
@@ -10,6 +23,75 @@ type VC struct {
 	// All version control operations (e.g., commit, add, status)
 	// will be applied to this WorkDir.
 	wd *workdir.WorkDir
+
+	// index is the staging area: the snapshot that the next commit will record.
+	index *workdir.WorkDir
+
+	// base is the snapshot of the WorkDir at Init time.
+	// It plays the role of HEAD until the first commit is made.
+	base *workdir.WorkDir
+
+	// head is the ID of the latest commit ("" when there is no commit yet).
+	head string
+
+	// commits stores every commit by its ID.
+	commits map[string]*commit
+
+	// submodules maps the path of every nested repository to its VC.
+	submodules map[string]*VC
+
+	// pins is the staged commit ID of every nested repository (path → commit ID).
+	pins map[string]string
+
+	// tags stores every tag by its name.
+	tags map[string]*tag
+
+	// signer signs new commits and tags when it is set.
+	signer Signer
+
+	// config holds the repository settings, such as the trusted keyring.
+	config *Config
+}
+
+// commit is a single recorded snapshot of the staging area.
+type commit struct {
+	id      string
+	parent  string // "" for the first commit
+	message string
+	time    time.Time
+	tree    *workdir.WorkDir
+	pins    map[string]string // commit ID of every nested repository, by path
+
+	keyID     string // ID of the key that signed the commit ("" when unsigned)
+	signature []byte // signature over the canonical encoding of the commit
+}
+
+// CommitInfo describes a commit, as reported by History.
+type CommitInfo struct {
+	ID        string
+	Parent    string // "" for the first commit
+	Message   string
+	Time      time.Time
+	KeyID     string          // ID of the signing key, "" when unsigned
+	Signature SignatureStatus // only filled when HistoryOptions.VerifySignatures is set
+}
+
+// HistoryOptions controls what History reports about every commit.
+type HistoryOptions struct {
+	// VerifySignatures checks the signature of every commit against the trusted keyring.
+	VerifySignatures bool
+}
+
+// Status describes the difference between the WorkDir, the staging area and HEAD.
+type Status struct {
+	// ModifiedFiles are files whose WorkDir content differs from the staging area
+	// (including new files that were never added).
+	ModifiedFiles []string
+	// StagedFiles are files whose staged content differs from HEAD.
+	// A nested repository whose staged commit differs from HEAD is listed by its path.
+	StagedFiles []string
+	// MovedSubmodules are nested repositories whose HEAD is not the staged commit anymore.
+	MovedSubmodules []string
 }
 
 // Init initializes and returns a new VC (Version Control) instance.
@@ -17,7 +99,14 @@ type VC struct {
 // that this VC will manage.
 func Init(w *workdir.WorkDir) *VC {
 	return &VC{
-		wd: w, // assign the provided WorkDir to this VC
+		wd:         w, // assign the provided WorkDir to this VC
+		index:      w.Clone(),
+		base:       w.Clone(),
+		commits:    make(map[string]*commit),
+		submodules: make(map[string]*VC),
+		pins:       make(map[string]string),
+		tags:       make(map[string]*tag),
+		config:     newConfig(),
 	}
 }
 
@@ -27,3 +116,341 @@ func Init(w *workdir.WorkDir) *VC {
 func (v *VC) GetWorkDir() *workdir.WorkDir {
 	return v.wd
 }
+
+// Add copies the current content of the given files from the WorkDir
+// into the staging area, creating their parent directories if needed.
+// Adding the path of a nested repository stages its current HEAD commit.
+func (v *VC) Add(paths ...string) error {
+	for _, p := range paths {
+		if sub, ok := v.submodules[p]; ok {
+			v.pins[p] = sub.head
+			continue
+		}
+		if s := v.submoduleOf(p); s != "" {
+			return fmt.Errorf("%s is inside the nested repository %s", p, s)
+		}
+
+		content, err := v.wd.CatFile(p)
+		if err != nil {
+			return err
+		}
+		v.stage(p, content)
+	}
+	return nil
+}
+
+// AddAll stages every file and directory of the WorkDir, and the current
+// HEAD of every nested repository.
+func (v *VC) AddAll() {
+	for _, d := range v.wd.ListDirs() {
+		if v.submoduleOf(d) == "" {
+			ensureDir(v.index, d)
+			v.copyAttrs(d)
+		}
+	}
+	for _, p := range v.wd.ListFilesRoot() {
+		if v.submoduleOf(p) != "" {
+			continue
+		}
+		content, _ := v.wd.CatFile(p) // cannot fail: p comes from the WorkDir itself
+		v.stage(p, content)
+	}
+	for p, sub := range v.submodules {
+		v.pins[p] = sub.head
+	}
+}
+
+// stage writes a file into the staging area.
+func (v *VC) stage(p, content string) {
+	if dir := path.Dir(p); dir != "." {
+		ensureDir(v.index, dir)
+	}
+	if _, err := v.index.CatFile(p); err != nil {
+		v.index.CreateFile(p)
+	}
+	v.index.WriteToFile(p, content)
+	v.copyAttrs(p)
+}
+
+// copyAttrs copies the mode and modification time of a WorkDir file or
+// directory into the staging area, so checkouts and archives restore them.
+func (v *VC) copyAttrs(p string) {
+	if info, err := v.wd.Stat(p); err == nil {
+		v.index.Chmod(p, info.Mode)
+		v.index.Chtimes(p, info.ModTime)
+	}
+}
+
+// ensureDir creates dir and all of its parents in w if they are missing.
+func ensureDir(w *workdir.WorkDir, dir string) {
+	existing := make(map[string]bool)
+	for _, d := range w.ListDirs() {
+		existing[d] = true
+	}
+	parts := strings.Split(dir, "/")
+	for i := range parts {
+		d := strings.Join(parts[:i+1], "/")
+		if !existing[d] {
+			w.CreateDir(d)
+		}
+	}
+}
+
+// Commit records the staging area as a new commit on top of HEAD.
+// Like `git commit --allow-empty`, a commit is made even if nothing changed.
+// When a signer is set, the commit carries a signature over its canonical encoding.
+func (v *VC) Commit(message string) error {
+	c := &commit{
+		parent:  v.head,
+		message: message,
+		time:    time.Now(),
+		tree:    v.index.Clone(),
+		pins:    make(map[string]string, len(v.pins)),
+	}
+	for p, id := range v.pins {
+		c.pins[p] = id
+	}
+	if v.signer != nil {
+		sig, err := v.signer.Sign(encodeCommit(c))
+		if err != nil {
+			return fmt.Errorf("cannot sign commit: %w", err)
+		}
+		c.keyID, c.signature = v.signer.KeyID(), sig
+	}
+	c.id = hashCommit(c)
+
+	v.commits[c.id] = c
+	v.head = c.id
+	return nil
+}
+
+// Status compares the WorkDir with the staging area and the staging area with HEAD.
+// Both lists are sorted.
+// Files inside nested repositories are not reported; the nested repository
+// itself is reported instead when its HEAD moved.
+func (v *VC) Status() Status {
+	s := Status{
+		ModifiedFiles:   make([]string, 0),
+		StagedFiles:     diffFiles(v.headTree(), v.index),
+		MovedSubmodules: make([]string, 0),
+	}
+	for _, p := range diffFiles(v.index, v.wd) {
+		if v.submoduleOf(p) == "" {
+			s.ModifiedFiles = append(s.ModifiedFiles, p)
+		}
+	}
+
+	headPins := v.headPins()
+	for p, sub := range v.submodules {
+		if headPins[p] != v.pins[p] {
+			s.StagedFiles = append(s.StagedFiles, p)
+		}
+		if sub.head != v.pins[p] {
+			s.MovedSubmodules = append(s.MovedSubmodules, p)
+		}
+	}
+	sort.Strings(s.StagedFiles)
+	sort.Strings(s.MovedSubmodules)
+	return s
+}
+
+// diffFiles returns the files of `to` that are missing from `from` or have a different content.
+func diffFiles(from, to *workdir.WorkDir) []string {
+	res := make([]string, 0)
+	for _, p := range to.ListFilesRoot() {
+		newContent, _ := to.CatFile(p)
+		oldContent, err := from.CatFile(p)
+		if err != nil || oldContent != newContent {
+			res = append(res, p)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// headTree returns the snapshot HEAD points to, or the initial WorkDir when there is no commit.
+func (v *VC) headTree() *workdir.WorkDir {
+	if v.head == "" {
+		return v.base
+	}
+	return v.commits[v.head].tree
+}
+
+// Log returns the commit messages from the newest to the oldest.
+func (v *VC) Log() []string {
+	res := make([]string, 0)
+	for c := v.commits[v.head]; c != nil; c = v.commits[c.parent] {
+		res = append(res, c.message)
+	}
+	return res
+}
+
+// History returns information about every commit from the newest to the oldest.
+func (v *VC) History(opts HistoryOptions) []CommitInfo {
+	res := make([]CommitInfo, 0)
+	for c := v.commits[v.head]; c != nil; c = v.commits[c.parent] {
+		info := CommitInfo{
+			ID:      c.id,
+			Parent:  c.parent,
+			Message: c.message,
+			Time:    c.time,
+			KeyID:   c.keyID,
+		}
+		if opts.VerifySignatures {
+			info.Signature = v.verify(c.keyID, c.signature, encodeCommit(c))
+		}
+		res = append(res, info)
+	}
+	return res
+}
+
+// Checkout returns a copy of the WorkDir as it was recorded in the given revision.
+// The managed WorkDir is not changed.
+func (v *VC) Checkout(rev string) (*workdir.WorkDir, error) {
+	c, err := v.resolve(rev)
+	if err != nil {
+		return nil, err
+	}
+	return c.tree.Clone(), nil
+}
+
+// resolve finds the commit a revision points to. Supported forms are:
+//   - "" or "HEAD": the latest commit
+//   - "~N", "^", "^^", ... (optionally prefixed with "HEAD", a tag or a commit ID):
+//     walk N parents back, where "~" alone means one and every "^" means one
+//   - a tag name
+//   - a commit ID or a unique prefix of at least 4 characters
+func (v *VC) resolve(rev string) (*commit, error) {
+	if v.head == "" {
+		return nil, fmt.Errorf("there is no commit yet")
+	}
+
+	// Split the revision into a starting point and a relative suffix.
+	i := strings.IndexAny(rev, "~^")
+	start, suffix := rev, ""
+	if i >= 0 {
+		start, suffix = rev[:i], rev[i:]
+	}
+
+	var c *commit
+	if start == "" || start == "HEAD" {
+		c = v.commits[v.head]
+	} else {
+		var err error
+		if c, err = v.lookup(start); err != nil {
+			return nil, err
+		}
+	}
+
+	steps, err := parseAncestry(suffix)
+	if err != nil {
+		return nil, fmt.Errorf("invalid revision %q: %w", rev, err)
+	}
+	for ; steps > 0; steps-- {
+		c = v.commits[c.parent]
+		if c == nil {
+			return nil, fmt.Errorf("revision %q goes past the first commit", rev)
+		}
+	}
+	return c, nil
+}
+
+// lookup finds a commit by a tag name, its full ID or a unique prefix of it.
+func (v *VC) lookup(id string) (*commit, error) {
+	if t, ok := v.tags[id]; ok {
+		return v.commits[t.target], nil
+	}
+	if c, ok := v.commits[id]; ok {
+		return c, nil
+	}
+	if len(id) < 4 {
+		return nil, fmt.Errorf("unknown revision: %s", id)
+	}
+	var found *commit
+	for k, c := range v.commits {
+		if strings.HasPrefix(k, id) {
+			if found != nil {
+				return nil, fmt.Errorf("ambiguous revision: %s", id)
+			}
+			found = c
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("unknown revision: %s", id)
+	}
+	return found, nil
+}
+
+// parseAncestry counts how many parents a suffix like "~2^^" walks back.
+func parseAncestry(suffix string) (int, error) {
+	steps := 0
+	for len(suffix) > 0 {
+		switch suffix[0] {
+		case '^':
+			steps++
+			suffix = suffix[1:]
+		case '~':
+			j := 1
+			for j < len(suffix) && suffix[j] >= '0' && suffix[j] <= '9' {
+				j++
+			}
+			n := 1
+			if j > 1 {
+				var err error
+				if n, err = strconv.Atoi(suffix[1:j]); err != nil {
+					return 0, err
+				}
+			}
+			steps += n
+			suffix = suffix[j:]
+		default:
+			return 0, fmt.Errorf("unexpected %q", suffix[0])
+		}
+	}
+	return steps, nil
+}
+
+// encodeCommit returns the canonical byte encoding of a commit.
+// Directories and files are sorted, so equal commits always encode the same way.
+func encodeCommit(c *commit) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "parent %s\n", c.parent)
+	fmt.Fprintf(&buf, "time %d\n", c.time.UnixNano())
+
+	dirs := c.tree.ListDirs()
+	sort.Strings(dirs)
+	for _, d := range dirs {
+		fmt.Fprintf(&buf, "dir %s\n", d)
+	}
+
+	files := c.tree.ListFilesRoot()
+	sort.Strings(files)
+	for _, f := range files {
+		content, _ := c.tree.CatFile(f)
+		info, _ := c.tree.Stat(f)
+		fmt.Fprintf(&buf, "file %s %o %d\n%s\n", f, info.Mode, len(content), content)
+	}
+
+	pins := make([]string, 0, len(c.pins))
+	for p := range c.pins {
+		pins = append(pins, p)
+	}
+	sort.Strings(pins)
+	for _, p := range pins {
+		fmt.Fprintf(&buf, "submodule %s %s\n", p, c.pins[p])
+	}
+
+	fmt.Fprintf(&buf, "\n%s", c.message)
+	return buf.Bytes()
+}
+
+// hashCommit computes the ID of a commit from its canonical encoding and,
+// like git, from its signature too.
+func hashCommit(c *commit) string {
+	h := sha256.New()
+	h.Write(encodeCommit(c))
+	if c.keyID != "" {
+		fmt.Fprintf(h, "\nsignature %s %s", c.keyID, base64.StdEncoding.EncodeToString(c.signature))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
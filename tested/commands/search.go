@@ -0,0 +1,19 @@
+package commands
+
+import "vc/workdir"
+
+// Grep searches the snapshot recorded in the given revision, exactly like
+// WorkDir.Grep does on a live WorkDir. Options are optional; only the first
+// one is used when several are passed.
+func (v *VC) Grep(rev, expr string, opts ...workdir.GrepOptions) ([]workdir.GrepMatch, error) {
+	c, err := v.resolve(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	var o workdir.GrepOptions
+	if len(opts) > 0 {
+		o = opts[0]
+	}
+	return c.tree.Grep(expr, o)
+}
@@ -0,0 +1,123 @@
+package commands
+
+import (
+	"crypto/ed25519"
+	"fmt"
+)
+
+// Signer signs commits and tags. KeyID names the key, so verifiers can
+// find the matching public key in their keyring.
+type Signer interface {
+	KeyID() string
+	Sign(data []byte) ([]byte, error)
+}
+
+// Ed25519Signer is a Signer backed by an Ed25519 private key.
+type Ed25519Signer struct {
+	id  string
+	key ed25519.PrivateKey
+}
+
+// NewEd25519Signer returns a Signer that signs with key under the given key ID.
+func NewEd25519Signer(id string, key ed25519.PrivateKey) (*Ed25519Signer, error) {
+	if id == "" {
+		return nil, fmt.Errorf("key id must not be empty")
+	}
+	if len(key) != ed25519.PrivateKeySize {
+		return nil, fmt.Errorf("invalid ed25519 private key size: %d", len(key))
+	}
+	return &Ed25519Signer{id: id, key: key}, nil
+}
+
+func (s *Ed25519Signer) KeyID() string {
+	return s.id
+}
+
+func (s *Ed25519Signer) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(s.key, data), nil
+}
+
+// SignatureStatus is the result of checking the signature of a commit or tag.
+type SignatureStatus int
+
+const (
+	SignatureUnchecked  SignatureStatus = iota // the signature was not verified
+	SignatureNone                              // the object is not signed
+	SignatureGood                              // signed by a trusted key, and the signature matches
+	SignatureBad                               // signed by a trusted key, but the signature does not match
+	SignatureUnknownKey                        // signed by a key that is not in the keyring
+)
+
+func (s SignatureStatus) String() string {
+	switch s {
+	case SignatureNone:
+		return "unsigned"
+	case SignatureGood:
+		return "good"
+	case SignatureBad:
+		return "bad"
+	case SignatureUnknownKey:
+		return "unknown key"
+	default:
+		return "unchecked"
+	}
+}
+
+// Config holds the settings of a repository.
+type Config struct {
+	// keyring maps a key ID to the public key trusted for it.
+	keyring map[string]ed25519.PublicKey
+}
+
+func newConfig() *Config {
+	return &Config{keyring: make(map[string]ed25519.PublicKey)}
+}
+
+// TrustKey adds a public key to the trusted keyring, replacing any key with the same ID.
+func (c *Config) TrustKey(id string, key ed25519.PublicKey) error {
+	if len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("invalid ed25519 public key size: %d", len(key))
+	}
+	c.keyring[id] = key
+	return nil
+}
+
+// RevokeKey removes a key from the trusted keyring.
+func (c *Config) RevokeKey(id string) {
+	delete(c.keyring, id)
+}
+
+// Config returns the settings of the repository.
+func (v *VC) Config() *Config {
+	return v.config
+}
+
+// SetSigner sets the signer used for new commits and tags; nil disables signing.
+func (v *VC) SetSigner(s Signer) {
+	v.signer = s
+}
+
+// VerifyCommit checks the signature of the commit the revision points to
+// against the trusted keyring.
+func (v *VC) VerifyCommit(rev string) (SignatureStatus, error) {
+	c, err := v.resolve(rev)
+	if err != nil {
+		return SignatureUnchecked, err
+	}
+	return v.verify(c.keyID, c.signature, encodeCommit(c)), nil
+}
+
+// verify checks a signature made by keyID over data.
+func (v *VC) verify(keyID string, sig, data []byte) SignatureStatus {
+	if keyID == "" {
+		return SignatureNone
+	}
+	key, ok := v.config.keyring[keyID]
+	if !ok {
+		return SignatureUnknownKey
+	}
+	if !ed25519.Verify(key, data, sig) {
+		return SignatureBad
+	}
+	return SignatureGood
+}
@@ -0,0 +1,97 @@
+package commands
+
+import (
+	"fmt"
+	"strings"
+
+	"vc/workdir"
+)
+
+// AddSubmodule records the subtree at path as a nested repository managed by sub.
+// The subtree of the WorkDir is replaced by the snapshot of sub's HEAD (recursively),
+// and that commit is staged as the pinned commit of the nested repository.
+// Files under path are not tracked by this VC anymore.
+func (v *VC) AddSubmodule(path string, sub *VC) error {
+	if path == "" || strings.HasPrefix(path, "/") {
+		return fmt.Errorf("invalid submodule path: %q", path)
+	}
+	if sub == v {
+		return fmt.Errorf("a repository cannot contain itself")
+	}
+	if s := v.submoduleOf(path); s != "" {
+		return fmt.Errorf("%s is inside the nested repository %s", path, s)
+	}
+	for s := range v.submodules {
+		if strings.HasPrefix(s, path+"/") {
+			return fmt.Errorf("%s already contains the nested repository %s", path, s)
+		}
+	}
+
+	content, err := sub.CheckoutRecursive("HEAD")
+	if err != nil {
+		return fmt.Errorf("cannot add submodule %s: %w", path, err)
+	}
+
+	// Replace whatever was at path, both in the WorkDir and in the staging area.
+	// The staging area only keeps an empty directory, like git does.
+	v.wd.Remove(path)
+	if err := graft(v.wd, path, content); err != nil {
+		return err
+	}
+	v.index.Remove(path)
+	ensureDir(v.index, path)
+
+	v.submodules[path] = sub
+	v.pins[path] = sub.head
+	return nil
+}
+
+// Submodule returns the VC of the nested repository at path.
+func (v *VC) Submodule(path string) (*VC, error) {
+	sub, ok := v.submodules[path]
+	if !ok {
+		return nil, fmt.Errorf("no submodule at %s", path)
+	}
+	return sub, nil
+}
+
+// CheckoutRecursive is like Checkout, but also fills the directory of every
+// nested repository with its content at the commit pinned by the revision.
+func (v *VC) CheckoutRecursive(rev string) (*workdir.WorkDir, error) {
+	c, err := v.resolve(rev)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := c.tree.Clone()
+	for p, id := range c.pins {
+		content, err := v.submodules[p].CheckoutRecursive(id)
+		if err != nil {
+			return nil, fmt.Errorf("submodule %s: %w", p, err)
+		}
+		tree.Remove(p)
+		if err := graft(tree, p, content); err != nil {
+			return nil, err
+		}
+	}
+	return tree, nil
+}
+
+// submoduleOf returns the path of the nested repository that contains p,
+// or "" if p is tracked by this VC.
+func (v *VC) submoduleOf(p string) string {
+	for s := range v.submodules {
+		if p == s || strings.HasPrefix(p, s+"/") {
+			return s
+		}
+	}
+	return ""
+}
+
+// headPins returns the pinned commits recorded in HEAD (nil when there is no commit).
+func (v *VC) headPins() map[string]string {
+	if v.head == "" {
+		return nil
+	}
+	return v.commits[v.head].pins
+}
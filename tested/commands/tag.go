@@ -0,0 +1,70 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// tag is an annotated name for a commit.
+type tag struct {
+	name    string
+	target  string // ID of the tagged commit
+	message string
+	time    time.Time
+
+	keyID     string // ID of the key that signed the tag ("" when unsigned)
+	signature []byte // signature over the canonical encoding of the tag
+}
+
+// Tag creates an annotated tag pointing to the commit of the given revision.
+// When a signer is set, the tag is signed. Tag names can then be used as revisions.
+func (v *VC) Tag(name, rev, message string) error {
+	if name == "" || name == "HEAD" || strings.ContainsAny(name, "~^ ") {
+		return fmt.Errorf("invalid tag name: %q", name)
+	}
+	if _, ok := v.tags[name]; ok {
+		return fmt.Errorf("tag already exists: %s", name)
+	}
+	c, err := v.resolve(rev)
+	if err != nil {
+		return err
+	}
+
+	t := &tag{
+		name:    name,
+		target:  c.id,
+		message: message,
+		time:    time.Now(),
+	}
+	if v.signer != nil {
+		sig, err := v.signer.Sign(encodeTag(t))
+		if err != nil {
+			return fmt.Errorf("cannot sign tag: %w", err)
+		}
+		t.keyID, t.signature = v.signer.KeyID(), sig
+	}
+
+	v.tags[name] = t
+	return nil
+}
+
+// VerifyTag checks the signature of a tag against the trusted keyring.
+func (v *VC) VerifyTag(name string) (SignatureStatus, error) {
+	t, ok := v.tags[name]
+	if !ok {
+		return SignatureUnchecked, fmt.Errorf("unknown tag: %s", name)
+	}
+	return v.verify(t.keyID, t.signature, encodeTag(t)), nil
+}
+
+// encodeTag returns the canonical byte encoding of a tag.
+func encodeTag(t *tag) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "object %s\n", t.target)
+	fmt.Fprintf(&buf, "tag %s\n", t.name)
+	fmt.Fprintf(&buf, "time %d\n", t.time.UnixNano())
+	fmt.Fprintf(&buf, "\n%s", t.message)
+	return buf.Bytes()
+}
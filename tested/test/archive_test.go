@@ -0,0 +1,138 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"io/fs"
+	"testing"
+	"time"
+	"vc/commands"
+	"vc/workdir"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var archiveTime = time.Date(2024, 3, 1, 12, 30, 0, 0, time.UTC)
+
+func archiveWorkDir() *workdir.WorkDir {
+	w := wd.Clone()
+	w.CreateDir("bin")
+	w.CreateFile("bin/run.sh")
+	w.WriteToFile("bin/run.sh", "#!/bin/sh\necho hi\n")
+	w.Chmod("bin/run.sh", 0o755)
+	w.Chmod("src/workdir", 0o700)
+	for _, p := range append(w.ListFilesRoot(), w.ListDirs()...) {
+		w.Chtimes(p, archiveTime)
+	}
+	return w
+}
+
+func assertSameWorkDir(t *testing.T, expected, actual *workdir.WorkDir) {
+	assert.ElementsMatch(t, expected.ListFilesRoot(), actual.ListFilesRoot())
+	assert.ElementsMatch(t, expected.ListDirs(), actual.ListDirs())
+	for _, p := range append(expected.ListFilesRoot(), expected.ListDirs()...) {
+		e, _ := expected.Stat(p)
+		a, err := actual.Stat(p)
+		assert.NoError(t, err)
+		assert.Equal(t, e.Mode, a.Mode, p)
+		assert.True(t, e.ModTime.Equal(a.ModTime), p)
+		expectedContent, _ := expected.CatFile(p)
+		actualContent, _ := actual.CatFile(p)
+		assert.Equal(t, expectedContent, actualContent, p)
+	}
+}
+
+func TestTarRoundTrip(t *testing.T) {
+	w := archiveWorkDir()
+	var buf bytes.Buffer
+	assert.NoError(t, w.ExportTar(&buf))
+
+	imported := workdir.InitEmptyWorkDir()
+	assert.NoError(t, imported.ImportTar(&buf))
+	assertSameWorkDir(t, w, imported)
+}
+
+func TestZipRoundTrip(t *testing.T) {
+	w := archiveWorkDir()
+	var buf bytes.Buffer
+	assert.NoError(t, w.ExportZip(&buf))
+
+	imported := workdir.InitEmptyWorkDir()
+	assert.NoError(t, imported.ImportZip(&buf))
+	assertSameWorkDir(t, w, imported)
+}
+
+func TestImportRejectsTraversal(t *testing.T) {
+	for _, name := range []string{"../evil", "/etc/passwd", "src/../../evil", "C:/evil", `C:\evil`, "C:evil"} {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		tw.WriteHeader(&tar.Header{Name: "ok.txt", Typeflag: tar.TypeReg, Mode: 0o644})
+		tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0o644})
+		tw.Close()
+
+		w := workdir.InitEmptyWorkDir()
+		assert.Error(t, w.ImportTar(&buf), name)
+		assert.Len(t, w.ListFilesRoot(), 0, "a failed import must not change the work dir")
+
+		buf.Reset()
+		zw := zip.NewWriter(&buf)
+		zw.Create(name)
+		zw.Close()
+		assert.Error(t, w.ImportZip(&buf), name)
+	}
+}
+
+func TestImportCreatesParents(t *testing.T) {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	tw.WriteHeader(&tar.Header{Name: "./a/b/c.txt", Typeflag: tar.TypeReg, Mode: 0o600, Size: 2})
+	tw.Write([]byte("hi"))
+	tw.Close()
+
+	w := workdir.InitEmptyWorkDir()
+	assert.NoError(t, w.ImportTar(&buf))
+	assert.ElementsMatch(t, []string{"a", "a/b"}, w.ListDirs())
+	info, err := w.Stat("a/b/c.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0o600), info.Mode)
+}
+
+func TestVCArchive(t *testing.T) {
+	vc := commands.Init(archiveWorkDir())
+	vc.AddAll()
+	vc.Commit("first")
+	vc.GetWorkDir().WriteToFile("README.md", "changed")
+	// A directory created after Init keeps its attributes too.
+	vc.GetWorkDir().CreateDir("docs")
+	vc.GetWorkDir().Chmod("docs", 0o750)
+	vc.GetWorkDir().Chtimes("docs", archiveTime)
+	vc.AddAll()
+	vc.Commit("second")
+
+	var buf bytes.Buffer
+	assert.NoError(t, vc.Archive("~1", commands.ArchiveZip, &buf, "release/"))
+
+	imported := workdir.InitEmptyWorkDir()
+	assert.NoError(t, imported.ImportZip(&buf))
+	content, err := imported.CatFile("release/README.md")
+	assert.NoError(t, err)
+	assert.Equal(t, "### MY GIT IMPL", content)
+	info, err := imported.Stat("release/bin/run.sh")
+	assert.NoError(t, err)
+	assert.Equal(t, fs.FileMode(0o755), info.Mode)
+
+	buf.Reset()
+	assert.NoError(t, vc.Archive("HEAD", commands.ArchiveTar, &buf, ""))
+	imported = workdir.InitEmptyWorkDir()
+	assert.NoError(t, imported.ImportTar(&buf))
+	content, _ = imported.CatFile("README.md")
+	assert.Equal(t, "changed", content)
+	info, err = imported.Stat("docs")
+	assert.NoError(t, err)
+	assert.True(t, info.IsDir)
+	assert.Equal(t, fs.FileMode(0o750), info.Mode)
+	assert.True(t, info.ModTime.Equal(archiveTime))
+
+	assert.Error(t, vc.Archive("HEAD", "rar", &buf, ""))
+}
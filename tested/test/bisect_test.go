@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"vc/commands"
+	"vc/workdir"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// bisectRepo makes 10 commits; the regression ("BUG") appears in commit 6.
+// It returns the VC and the commit IDs from the oldest to the newest.
+func bisectRepo() (*commands.VC, []string) {
+	vc := commands.Init(wd.Clone())
+	for i := 0; i < 10; i++ {
+		line := fmt.Sprintf("\nversion %d", i)
+		if i >= 6 {
+			line += " BUG"
+		}
+		vc.GetWorkDir().AppendToFile("src/main.go", line)
+		vc.AddAll()
+		vc.Commit(fmt.Sprintf("commit %d", i))
+	}
+
+	history := vc.History(commands.HistoryOptions{})
+	ids := make([]string, len(history))
+	for i, c := range history {
+		ids[len(history)-1-i] = c.ID
+	}
+	return vc, ids
+}
+
+func hasBug(w *workdir.WorkDir) (commands.BisectResult, error) {
+	content, err := w.CatFile("src/main.go")
+	if err != nil {
+		return commands.BisectSkip, err
+	}
+	if strings.Contains(content, "BUG") {
+		return commands.BisectBad, nil
+	}
+	return commands.BisectGood, nil
+}
+
+func TestBisect(t *testing.T) {
+	vc, ids := bisectRepo()
+
+	first, log, err := vc.Bisect(ids[0], "HEAD", hasBug)
+	assert.NoError(t, err)
+	assert.Equal(t, ids[6], first)
+	assert.LessOrEqual(t, len(log), 4)
+	for _, step := range log {
+		assert.NotEqual(t, commands.BisectSkip, step.Result)
+	}
+}
+
+func TestBisectSkip(t *testing.T) {
+	vc, ids := bisectRepo()
+
+	// Commits 5 and 6 cannot be tested, so the first bad commit is ambiguous.
+	first, log, err := vc.Bisect(ids[0], ids[9], func(w *workdir.WorkDir) (commands.BisectResult, error) {
+		content, _ := w.CatFile("src/main.go")
+		if strings.HasSuffix(content, "version 5") || strings.HasSuffix(content, "version 6 BUG") {
+			return commands.BisectSkip, nil
+		}
+		return hasBug(w)
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), ids[6])
+	assert.Contains(t, err.Error(), ids[7])
+	assert.Equal(t, "", first)
+	assert.NotEmpty(t, log)
+}
+
+func TestBisectErrors(t *testing.T) {
+	vc, ids := bisectRepo()
+
+	_, _, err := vc.Bisect("HEAD", ids[0], hasBug)
+	assert.Error(t, err, "good must be an ancestor of bad")
+
+	_, _, err = vc.Bisect(ids[0], "HEAD", func(*workdir.WorkDir) (commands.BisectResult, error) {
+		return commands.BisectGood, errors.New("build failed")
+	})
+	assert.Error(t, err)
+}
+
+func TestBisectManual(t *testing.T) {
+	vc, ids := bisectRepo()
+
+	s, err := vc.StartBisect(ids[2], "HEAD")
+	assert.NoError(t, err)
+	for !s.Done() {
+		_, w, err := s.Current()
+		assert.NoError(t, err)
+		result, _ := hasBug(w)
+		assert.NoError(t, s.Mark(result))
+	}
+
+	first, err := s.FirstBad()
+	assert.NoError(t, err)
+	assert.Equal(t, ids[6], first)
+	assert.Error(t, s.Mark(commands.BisectGood))
+}
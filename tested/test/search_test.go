@@ -0,0 +1,91 @@
+package main
+
+import (
+	"testing"
+	"vc/commands"
+	"vc/workdir"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func searchWorkDir() *workdir.WorkDir {
+	w := wd.Clone()
+	w.WriteToFile("README.md", "# Todo\nfix the parser\nFIX the lexer")
+	w.WriteToFile("src/main.go", "package main\n\nfunc main() { fixture() }")
+	w.WriteToFile("src/workdir/file1.go", "package workdir\n// fix me")
+	return w
+}
+
+func TestGlobDoubleStar(t *testing.T) {
+	w := searchWorkDir()
+
+	actual, err := w.Glob("src/**/*.go")
+	assert.NoError(t, err)
+	assert.Equal(t,
+		[]string{"src/main.go", "src/workdir/file1.go", "src/workdir/file2.go"},
+		actual,
+	)
+
+	actual, err = w.Glob("**/file?.go")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"src/workdir/file1.go", "src/workdir/file2.go"}, actual)
+
+	actual, err = w.Glob("*.md")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"README.md"}, actual)
+}
+
+func TestGlobBadPattern(t *testing.T) {
+	_, err := searchWorkDir().Glob("src/[")
+	assert.Error(t, err)
+}
+
+func TestGrep(t *testing.T) {
+	actual, err := searchWorkDir().Grep("fix", workdir.GrepOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t,
+		[]workdir.GrepMatch{
+			{File: "README.md", Line: 2, Column: 1, Text: "fix the parser"},
+			{File: "src/main.go", Line: 3, Column: 15, Text: "func main() { fixture() }"},
+			{File: "src/workdir/file1.go", Line: 2, Column: 4, Text: "// fix me"},
+		},
+		actual,
+	)
+}
+
+func TestGrepOptions(t *testing.T) {
+	w := searchWorkDir()
+
+	actual, err := w.Grep("fix", workdir.GrepOptions{IgnoreCase: true, WholeWord: true})
+	assert.NoError(t, err)
+	assert.Len(t, actual, 3)
+	assert.Equal(t, 3, actual[1].Line)
+
+	actual, err = w.Grep("fix", workdir.GrepOptions{Include: []string{"*.go"}, Exclude: []string{"src/workdir/**"}})
+	assert.NoError(t, err)
+	assert.Len(t, actual, 1)
+	assert.Equal(t, "src/main.go", actual[0].File)
+
+	_, err = w.Grep("(", workdir.GrepOptions{})
+	assert.Error(t, err)
+}
+
+func TestVCGrep(t *testing.T) {
+	vc := commands.Init(searchWorkDir())
+	vc.AddAll()
+	vc.Commit("first")
+	vc.GetWorkDir().WriteToFile("README.md", "nothing to do")
+	vc.AddAll()
+	vc.Commit("second")
+
+	actual, err := vc.Grep("HEAD", "parser")
+	assert.NoError(t, err)
+	assert.Len(t, actual, 0)
+
+	actual, err = vc.Grep("~1", "parser")
+	assert.NoError(t, err)
+	assert.Len(t, actual, 1)
+
+	_, err = vc.Grep("~5", "parser")
+	assert.Error(t, err)
+}
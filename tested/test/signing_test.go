@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"testing"
+	"vc/commands"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// forgingSigner claims to be a trusted key but signs with another one.
+type forgingSigner struct {
+	id  string
+	key ed25519.PrivateKey
+}
+
+func (s forgingSigner) KeyID() string { return s.id }
+
+func (s forgingSigner) Sign(data []byte) ([]byte, error) {
+	return ed25519.Sign(s.key, data), nil
+}
+
+func TestSignedCommits(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+	_, otherPriv, err := ed25519.GenerateKey(nil)
+	assert.NoError(t, err)
+
+	signer, err := commands.NewEd25519Signer("alice", priv)
+	assert.NoError(t, err)
+
+	vc := commands.Init(wd.Clone())
+	vc.AddAll()
+	assert.NoError(t, vc.Commit("unsigned"))
+	vc.SetSigner(signer)
+	assert.NoError(t, vc.Commit("signed by alice"))
+	vc.SetSigner(forgingSigner{id: "alice", key: otherPriv})
+	assert.NoError(t, vc.Commit("forged"))
+
+	// Nobody is trusted yet.
+	status, err := vc.VerifyCommit("~1")
+	assert.NoError(t, err)
+	assert.Equal(t, commands.SignatureUnknownKey, status)
+
+	assert.NoError(t, vc.Config().TrustKey("alice", pub))
+
+	for rev, expected := range map[string]commands.SignatureStatus{
+		"HEAD": commands.SignatureBad,
+		"~1":   commands.SignatureGood,
+		"~2":   commands.SignatureNone,
+	} {
+		status, err := vc.VerifyCommit(rev)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, status, rev)
+	}
+
+	history := vc.History(commands.HistoryOptions{VerifySignatures: true})
+	assert.Len(t, history, 3)
+	assert.Equal(t, "signed by alice", history[1].Message)
+	assert.Equal(t, "alice", history[1].KeyID)
+	assert.Equal(t, commands.SignatureGood, history[1].Signature)
+	assert.Equal(t, history[1].ID, history[0].Parent)
+
+	history = vc.History(commands.HistoryOptions{})
+	assert.Equal(t, commands.SignatureUnchecked, history[1].Signature)
+}
+
+func TestSignedTags(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(nil)
+	signer, _ := commands.NewEd25519Signer("release", priv)
+
+	vc := commands.Init(wd.Clone())
+	vc.AddAll()
+	vc.Commit("v1")
+	assert.NoError(t, vc.Tag("v1.0", "HEAD", "plain"))
+	vc.SetSigner(signer)
+	assert.NoError(t, vc.Tag("v1.0-signed", "HEAD", "signed"))
+	assert.Error(t, vc.Tag("v1.0", "HEAD", "duplicate"))
+
+	vc.Config().TrustKey("release", pub)
+	status, err := vc.VerifyTag("v1.0-signed")
+	assert.NoError(t, err)
+	assert.Equal(t, commands.SignatureGood, status)
+	status, _ = vc.VerifyTag("v1.0")
+	assert.Equal(t, commands.SignatureNone, status)
+	_, err = vc.VerifyTag("missing")
+	assert.Error(t, err)
+
+	vc.Config().RevokeKey("release")
+	status, _ = vc.VerifyTag("v1.0-signed")
+	assert.Equal(t, commands.SignatureUnknownKey, status)
+
+	// Tags can be used as revisions.
+	_, err = vc.Checkout("v1.0")
+	assert.NoError(t, err)
+}
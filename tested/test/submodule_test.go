@@ -0,0 +1,99 @@
+package main
+
+import (
+	"testing"
+	"vc/commands"
+	"vc/workdir"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func libRepo() *commands.VC {
+	w := workdir.InitEmptyWorkDir()
+	w.CreateFile("lib.go")
+	w.WriteToFile("lib.go", "package lib // v1")
+	lib := commands.Init(w)
+	lib.AddAll()
+	lib.Commit("lib v1")
+	return lib
+}
+
+func TestAddSubmodule(t *testing.T) {
+	lib := libRepo()
+	vc := commands.Init(wd.Clone())
+	assert.NoError(t, vc.AddSubmodule("vendor/lib", lib))
+
+	content, err := vc.GetWorkDir().CatFile("vendor/lib/lib.go")
+	assert.NoError(t, err)
+	assert.Equal(t, "package lib // v1", content)
+
+	status := vc.Status()
+	assert.Len(t, status.ModifiedFiles, 0)
+	assert.Equal(t, []string{"vendor/lib"}, status.StagedFiles)
+	assert.Len(t, status.MovedSubmodules, 0)
+
+	assert.Error(t, vc.Add("vendor/lib/lib.go"))
+	assert.Error(t, vc.AddSubmodule("vendor/lib/inner", libRepo()))
+	assert.Error(t, vc.AddSubmodule("other", commands.Init(workdir.InitEmptyWorkDir())))
+}
+
+func TestSubmoduleMoved(t *testing.T) {
+	lib := libRepo()
+	vc := commands.Init(wd.Clone())
+	vc.AddSubmodule("lib", lib)
+	vc.AddAll()
+	vc.Commit("add lib")
+
+	lib.GetWorkDir().WriteToFile("lib.go", "package lib // v2")
+	lib.AddAll()
+	lib.Commit("lib v2")
+
+	status := vc.Status()
+	assert.Equal(t, []string{"lib"}, status.MovedSubmodules)
+	assert.Len(t, status.StagedFiles, 0)
+
+	vc.Add("lib")
+	status = vc.Status()
+	assert.Len(t, status.MovedSubmodules, 0)
+	assert.Equal(t, []string{"lib"}, status.StagedFiles)
+	vc.Commit("bump lib")
+
+	{
+		wdC, err := vc.CheckoutRecursive("~1")
+		assert.NoError(t, err)
+		content, err := wdC.CatFile("lib/lib.go")
+		assert.NoError(t, err)
+		assert.Equal(t, "package lib // v1", content)
+		assert.Contains(t, wdC.ListFilesRoot(), "README.md")
+	}
+	{
+		wdC, err := vc.CheckoutRecursive("HEAD")
+		assert.NoError(t, err)
+		content, _ := wdC.CatFile("lib/lib.go")
+		assert.Equal(t, "package lib // v2", content)
+	}
+	{
+		// A plain checkout only leaves an empty directory for the nested repository.
+		wdC, err := vc.Checkout("HEAD")
+		assert.NoError(t, err)
+		assert.NotContains(t, wdC.ListFilesRoot(), "lib/lib.go")
+		assert.Contains(t, wdC.ListDirs(), "lib")
+	}
+}
+
+func TestNestedSubmodules(t *testing.T) {
+	inner := libRepo()
+	middle := commands.Init(workdir.InitEmptyWorkDir())
+	middle.AddSubmodule("inner", inner)
+	middle.Commit("middle")
+
+	vc := commands.Init(wd.Clone())
+	vc.AddSubmodule("middle", middle)
+	vc.Commit("outer")
+
+	wdC, err := vc.CheckoutRecursive("HEAD")
+	assert.NoError(t, err)
+	content, err := wdC.CatFile("middle/inner/lib.go")
+	assert.NoError(t, err)
+	assert.Equal(t, "package lib // v1", content)
+}
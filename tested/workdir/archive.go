@@ -0,0 +1,247 @@
+package workdir
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// archiveEntry is a file or directory read from an archive, before it is applied to a WorkDir.
+type archiveEntry struct {
+	path    string
+	isDir   bool
+	mode    fs.FileMode
+	modTime time.Time
+	content string
+}
+
+// ExportTar writes every directory and file of the WorkDir to w as a tar archive.
+// Directories come first, then files, both in sorted order; modes and
+// modification times are preserved (PAX headers keep sub-second precision).
+func (w *WorkDir) ExportTar(out io.Writer) error {
+	tw := tar.NewWriter(out)
+	for _, e := range w.entries() {
+		hdr := &tar.Header{
+			Name:    e.path,
+			Mode:    int64(e.mode),
+			ModTime: e.modTime,
+			Format:  tar.FormatPAX,
+		}
+		if e.isDir {
+			hdr.Typeflag = tar.TypeDir
+			hdr.Name += "/"
+		} else {
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = int64(len(e.content))
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return err
+		}
+		if _, err := io.WriteString(tw, e.content); err != nil {
+			return err
+		}
+	}
+	return tw.Close()
+}
+
+// ExportZip writes every directory and file of the WorkDir to w as a zip archive.
+// Zip stores modification times with a precision of one second.
+func (w *WorkDir) ExportZip(out io.Writer) error {
+	zw := zip.NewWriter(out)
+	for _, e := range w.entries() {
+		hdr := &zip.FileHeader{
+			Name:     e.path,
+			Modified: e.modTime,
+			Method:   zip.Deflate,
+		}
+		if e.isDir {
+			hdr.Name += "/"
+			hdr.Method = zip.Store
+			hdr.SetMode(fs.ModeDir | e.mode)
+		} else {
+			hdr.SetMode(e.mode)
+		}
+
+		fw, err := zw.CreateHeader(hdr)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(fw, e.content); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
+
+// ImportTar reads a tar archive into the WorkDir. Existing files with the same
+// path are overwritten and missing parent directories are created.
+// Only regular files and directories are supported. Entries with an absolute
+// path or a ".." component are rejected, and on any error the WorkDir is left unchanged.
+func (w *WorkDir) ImportTar(r io.Reader) error {
+	tr := tar.NewReader(r)
+	entries := make([]archiveEntry, 0)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		e := archiveEntry{
+			mode:    fs.FileMode(hdr.Mode).Perm(),
+			modTime: hdr.ModTime,
+		}
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			e.isDir = true
+		case tar.TypeReg:
+			content, err := io.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			e.content = string(content)
+		default:
+			return fmt.Errorf("unsupported tar entry type %q: %s", hdr.Typeflag, hdr.Name)
+		}
+		if e.path, err = cleanArchivePath(hdr.Name); err != nil {
+			return err
+		}
+		entries = append(entries, e)
+	}
+	return w.apply(entries)
+}
+
+// ImportZip reads a zip archive into the WorkDir, with the same rules as ImportTar.
+// The whole archive is buffered in memory because zip needs random access.
+func (w *WorkDir) ImportZip(r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return err
+	}
+
+	entries := make([]archiveEntry, 0, len(zr.File))
+	for _, f := range zr.File {
+		mode := f.Mode()
+		e := archiveEntry{
+			isDir:   mode.IsDir(),
+			mode:    mode.Perm(),
+			modTime: f.Modified,
+		}
+		if !e.isDir {
+			if !mode.IsRegular() {
+				return fmt.Errorf("unsupported zip entry type %s: %s", mode.Type(), f.Name)
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return err
+			}
+			content, err := io.ReadAll(rc)
+			rc.Close()
+			if err != nil {
+				return err
+			}
+			e.content = string(content)
+		}
+		if e.path, err = cleanArchivePath(f.Name); err != nil {
+			return err
+		}
+		entries = append(entries, e)
+	}
+	return w.apply(entries)
+}
+
+// entries returns all directories (sorted) followed by all files (sorted).
+// Sorting puts every parent directory before its children.
+func (w *WorkDir) entries() []archiveEntry {
+	dirs := w.ListDirs()
+	sort.Strings(dirs)
+	files := w.ListFilesRoot()
+	sort.Strings(files)
+
+	res := make([]archiveEntry, 0, len(dirs)+len(files))
+	for _, d := range dirs {
+		m := w.meta[d]
+		res = append(res, archiveEntry{path: d, isDir: true, mode: m.mode, modTime: m.modTime})
+	}
+	for _, f := range files {
+		m := w.meta[f]
+		res = append(res, archiveEntry{path: f, mode: m.mode, modTime: m.modTime, content: w.files[f]})
+	}
+	return res
+}
+
+// apply adds the entries to a copy of the WorkDir and only replaces the
+// WorkDir once every entry was applied, so a failing import changes nothing.
+func (w *WorkDir) apply(entries []archiveEntry) error {
+	tmp := w.Clone()
+	for _, e := range entries {
+		// Create any missing parent directory with default attributes.
+		parts := strings.Split(e.path, "/")
+		for i := 1; i < len(parts); i++ {
+			if err := tmp.mkdir(strings.Join(parts[:i], "/")); err != nil {
+				return err
+			}
+		}
+
+		if e.isDir {
+			if err := tmp.mkdir(e.path); err != nil {
+				return err
+			}
+		} else {
+			if tmp.dirs[e.path] {
+				return fmt.Errorf("a directory with the same name already exists: %s", e.path)
+			}
+			if _, ok := tmp.files[e.path]; !ok {
+				tmp.CreateFile(e.path)
+			}
+			tmp.files[e.path] = e.content
+		}
+		tmp.meta[e.path] = entryMeta{mode: e.mode, modTime: e.modTime}
+	}
+
+	*w = *tmp
+	return nil
+}
+
+// mkdir creates a directory unless it already exists.
+func (w *WorkDir) mkdir(dir string) error {
+	if w.dirs[dir] {
+		return nil
+	}
+	return w.CreateDir(dir)
+}
+
+// cleanArchivePath normalizes an archive entry name into a WorkDir path and
+// rejects names that could escape the WorkDir.
+func cleanArchivePath(name string) (string, error) {
+	segs := strings.Split(strings.ReplaceAll(name, `\`, "/"), "/")
+	// A drive letter ("C:/x", "C:x") points outside the WorkDir on Windows.
+	if strings.HasPrefix(name, "/") || strings.HasPrefix(name, `\`) || strings.Contains(segs[0], ":") {
+		return "", fmt.Errorf("archive entry has an absolute path: %s", name)
+	}
+	for _, seg := range segs {
+		if seg == ".." {
+			return "", fmt.Errorf("archive entry escapes the work dir: %s", name)
+		}
+	}
+
+	p := path.Clean(name)
+	if p == "." {
+		return "", fmt.Errorf("archive entry has an empty path: %q", name)
+	}
+	return p, nil
+}
@@ -0,0 +1,185 @@
+package workdir
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// GrepOptions controls how Grep searches the files of a WorkDir.
+type GrepOptions struct {
+	// Include limits the search to files matching at least one of these globs.
+	// An empty list means every file is searched.
+	Include []string
+	// Exclude skips every file matching one of these globs, even if it is included.
+	Exclude []string
+	// IgnoreCase makes the regular expression case-insensitive.
+	IgnoreCase bool
+	// WholeWord only reports matches that are surrounded by word boundaries.
+	WholeWord bool
+}
+
+// GrepMatch is a single match reported by Grep.
+// Line and Column are 1-based; Column counts bytes, like `grep --column`.
+type GrepMatch struct {
+	File   string
+	Line   int
+	Column int
+	Text   string // the full line that contains the match
+}
+
+// Glob returns all file paths that match the given pattern, sorted.
+// The pattern uses the syntax of path.Match for every path segment,
+// and a segment equal to "**" matches zero or more whole segments
+// (e.g., "src/**/*.go" matches "src/main.go" and "src/workdir/file1.go").
+func (w *WorkDir) Glob(pattern string) ([]string, error) {
+	if err := validateGlob(pattern); err != nil {
+		return nil, err
+	}
+
+	res := make([]string, 0)
+	for file := range w.files {
+		if matchGlob(pattern, file) {
+			res = append(res, file)
+		}
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// Grep searches every file of the WorkDir for the given regular expression
+// and returns all matches ordered by file, line and column.
+// Include and Exclude globs are checked against the whole path when they
+// contain a "/", and against the base name of the file otherwise (so "*.go"
+// matches Go files in any directory).
+func (w *WorkDir) Grep(expr string, opts GrepOptions) ([]GrepMatch, error) {
+	re, err := compileGrep(expr, opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if err := validateGlob(g); err != nil {
+			return nil, err
+		}
+	}
+
+	// Visit the files in a stable order so the result is deterministic.
+	files := make([]string, 0, len(w.files))
+	for file := range w.files {
+		if grepSelects(file, opts) {
+			files = append(files, file)
+		}
+	}
+	sort.Strings(files)
+
+	res := make([]GrepMatch, 0)
+	for _, file := range files {
+		for i, line := range strings.Split(w.files[file], "\n") {
+			for _, loc := range re.FindAllStringIndex(line, -1) {
+				res = append(res, GrepMatch{
+					File:   file,
+					Line:   i + 1,
+					Column: loc[0] + 1,
+					Text:   line,
+				})
+			}
+		}
+	}
+	return res, nil
+}
+
+// compileGrep builds the regular expression used by Grep from the user's
+// expression and the case/word options.
+func compileGrep(expr string, opts GrepOptions) (*regexp.Regexp, error) {
+	if opts.WholeWord {
+		expr = `\b(?:` + expr + `)\b`
+	}
+	if opts.IgnoreCase {
+		expr = `(?i)` + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regular expression: %w", err)
+	}
+	return re, nil
+}
+
+// grepSelects reports whether a file passes the Include/Exclude filters.
+func grepSelects(file string, opts GrepOptions) bool {
+	if len(opts.Include) > 0 {
+		included := false
+		for _, g := range opts.Include {
+			if matchFilter(g, file) {
+				included = true
+				break
+			}
+		}
+		if !included {
+			return false
+		}
+	}
+	for _, g := range opts.Exclude {
+		if matchFilter(g, file) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchFilter matches an Include/Exclude glob against a file path.
+// Patterns without a slash only look at the base name.
+func matchFilter(pattern, file string) bool {
+	if !strings.Contains(pattern, "/") {
+		return matchGlob(pattern, path.Base(file))
+	}
+	return matchGlob(pattern, file)
+}
+
+// validateGlob returns an error if any segment of the pattern is malformed.
+func validateGlob(pattern string) error {
+	for _, seg := range strings.Split(pattern, "/") {
+		if _, err := path.Match(seg, ""); err != nil {
+			return fmt.Errorf("invalid glob pattern: %s", pattern)
+		}
+	}
+	return nil
+}
+
+// matchGlob reports whether name matches the pattern, with "**" support.
+// The pattern must already be validated.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Collapse consecutive "**" segments; they mean the same thing.
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			// Try to match the rest of the pattern at every possible depth.
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern = pattern[1:]
+		name = name[1:]
+	}
+	return len(name) == 0
+}
@@ -2,7 +2,9 @@ package workdir
 
 import (
 	"fmt"
+	"io/fs"
 	"strings"
+	"time"
 )
 
 // you can use this library freely: "github.com/otiai10/copy"
@@ -10,8 +12,30 @@ import (
 // WorkDir represents an in-memory working directory.
 // It stores file paths and their content.
 type WorkDir struct {
-	files map[string]string // key: file path (e.g., "src/main.go"), value: file content
-	dirs  map[string]bool   // key: directory path (e.g., "src" or "src/workdir"), value: true means this directory exists
+	files map[string]string    // key: file path (e.g., "src/main.go"), value: file content
+	dirs  map[string]bool      // key: directory path (e.g., "src" or "src/workdir"), value: true means this directory exists
+	meta  map[string]entryMeta // key: file or directory path, value: its permission bits and modification time
+}
+
+// entryMeta holds the attributes of a file or directory that are not part of its content.
+type entryMeta struct {
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+// Default permission bits for new entries, the same as a typical umask 022 gives.
+const (
+	DefaultFileMode fs.FileMode = 0o644
+	DefaultDirMode  fs.FileMode = 0o755
+)
+
+// FileInfo describes a file or directory of a WorkDir.
+type FileInfo struct {
+	Path    string
+	IsDir   bool
+	Mode    fs.FileMode // permission bits only
+	ModTime time.Time
+	Size    int // content length in bytes, 0 for directories
 }
 
 // InitEmptyWorkDir creates and returns an empty working directory.
@@ -19,6 +43,7 @@ func InitEmptyWorkDir() *WorkDir {
 	return &WorkDir{
 		files: make(map[string]string),
 		dirs:  make(map[string]bool),
+		meta:  make(map[string]entryMeta),
 	}
 }
 
@@ -33,6 +58,7 @@ func (w *WorkDir) CreateFile(path string) error {
 	// The key is the file path, and the value (file content) starts as an empty string,
 	// meaning the file exists but is currently empty — just like running "touch file.txt".
 	w.files[path] = ""
+	w.meta[path] = entryMeta{mode: DefaultFileMode, modTime: time.Now()}
 
 	// Return nil to indicate that the file was successfully created.
 	return nil
@@ -56,6 +82,7 @@ func (w *WorkDir) CreateDir(path string) error {
 
 	// If the path is new, mark this directory as existing by setting it to true.
 	w.dirs[path] = true
+	w.meta[path] = entryMeta{mode: DefaultDirMode, modTime: time.Now()}
 
 	// Return nil to indicate the directory was successfully created.
 	return nil
@@ -72,6 +99,7 @@ func (w *WorkDir) WriteToFile(path string, content string) error {
 
 	// Overwrite the file content with the new data.
 	w.files[path] = content
+	w.touch(path)
 
 	// Return nil to indicate the operation was successful.
 	return nil
@@ -95,6 +123,11 @@ func (w *WorkDir) Clone() *WorkDir {
 		cloneWD.dirs[k] = v
 	}
 
+	// Copy the attributes (mode and modification time) of every entry.
+	for k, v := range w.meta {
+		cloneWD.meta[k] = v
+	}
+
 	// Return the fully cloned WorkDir instance.
 	return cloneWD
 }
@@ -154,6 +187,92 @@ func (w *WorkDir) AppendToFile(file string, newContent string) error {
 
 	// Update the map with the new (concatenated) content
 	w.files[file] = oldContent + newContent
+	w.touch(file)
+
+	return nil
+}
+
+// ListDirs returns the list of all directory paths stored in the WorkDir.
+// Like ListFilesRoot, the order of the result is not guaranteed.
+func (w *WorkDir) ListDirs() []string {
+	listDirs := make([]string, 0, len(w.dirs))
+	for k := range w.dirs {
+		listDirs = append(listDirs, k)
+	}
+	return listDirs
+}
+
+// Stat returns the attributes of the file or directory at the given path.
+func (w *WorkDir) Stat(path string) (FileInfo, error) {
+	m, ok := w.meta[path]
+	if !ok {
+		return FileInfo{}, fmt.Errorf("no such file or directory: %s", path)
+	}
+	content, isFile := w.files[path]
+	return FileInfo{
+		Path:    path,
+		IsDir:   !isFile,
+		Mode:    m.mode,
+		ModTime: m.modTime,
+		Size:    len(content),
+	}, nil
+}
 
+// Chmod changes the permission bits of a file or directory.
+// Bits other than the permission bits are ignored.
+func (w *WorkDir) Chmod(path string, mode fs.FileMode) error {
+	m, ok := w.meta[path]
+	if !ok {
+		return fmt.Errorf("no such file or directory: %s", path)
+	}
+	m.mode = mode.Perm()
+	w.meta[path] = m
+	return nil
+}
+
+// Chtimes changes the modification time of a file or directory.
+func (w *WorkDir) Chtimes(path string, modTime time.Time) error {
+	m, ok := w.meta[path]
+	if !ok {
+		return fmt.Errorf("no such file or directory: %s", path)
+	}
+	m.modTime = modTime
+	w.meta[path] = m
+	return nil
+}
+
+// touch updates the modification time of an entry after its content changed.
+func (w *WorkDir) touch(path string) {
+	m := w.meta[path]
+	m.modTime = time.Now()
+	w.meta[path] = m
+}
+
+// Remove deletes a file, or a directory together with everything under it.
+// It returns an error if nothing exists at the given path.
+func (w *WorkDir) Remove(path string) error {
+	if _, ok := w.files[path]; ok {
+		delete(w.files, path)
+		delete(w.meta, path)
+		return nil
+	}
+	if !w.dirs[path] {
+		return fmt.Errorf("no such file or directory: %s", path)
+	}
+
+	// Remove the directory itself and every file or directory below it.
+	prefix := path + "/"
+	for k := range w.files {
+		if strings.HasPrefix(k, prefix) {
+			delete(w.files, k)
+			delete(w.meta, k)
+		}
+	}
+	for k := range w.dirs {
+		if k == path || strings.HasPrefix(k, prefix) {
+			delete(w.dirs, k)
+			delete(w.meta, k)
+		}
+	}
 	return nil
 }